@@ -4,29 +4,59 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math/big"
 	"os"
 	"regexp"
 	"strconv"
 	"strings"
 )
 
+var one = big.NewInt(1)
+
+// IDs are kept as big.Ints so that ranges with 20+ digits don't overflow, and
+// so that we can work in any base from 2 to 36.
 type idRange struct {
-	lo       int
-	hi       int
-	loPrefix int
-	hiPrefix int
+	base int
+	lo   *big.Int
+	hi   *big.Int
+}
+
+func (r idRange) inRange(val *big.Int) bool {
+	return val.Cmp(r.lo) >= 0 && val.Cmp(r.hi) <= 0
 }
 
-func (r idRange) inRange(val int) bool {
-	return val >= r.lo && val <= r.hi
+func (r idRange) size() *big.Int {
+	size := new(big.Int).Sub(r.hi, r.lo)
+	return size.Add(size, one)
 }
 
 func (r idRange) String() string {
-	return fmt.Sprintf("%d-%d (prefix %d-%d), size %d\n", r.lo, r.hi, r.loPrefix, r.hiPrefix, r.hi-r.lo+1)
+	return fmt.Sprintf("%s-%s, size %s\n", r.lo.Text(r.base), r.hi.Text(r.base), r.size().Text(r.base))
+}
+
+// byDigitLength splits the range into sub-ranges whose IDs all have the same
+// number of digits, so 5-123456 becomes 5-9, 10-99, ..., 100000-123456.
+func (r idRange) byDigitLength() []idRange {
+	var subs []idRange
+	bigBase := big.NewInt(int64(r.base))
+	lo := new(big.Int).Set(r.lo)
+	for lo.Cmp(r.hi) <= 0 {
+		// the largest ID with as many digits as lo is base^len - 1
+		n := len(lo.Text(r.base))
+		hi := new(big.Int).Exp(bigBase, big.NewInt(int64(n)), nil)
+		hi.Sub(hi, one)
+		if hi.Cmp(r.hi) > 0 {
+			hi.Set(r.hi)
+		}
+		subs = append(subs, idRange{base: r.base, lo: new(big.Int).Set(lo), hi: hi})
+		lo.Add(hi, one)
+	}
+	return subs
 }
 
-func isSequence(val int) bool {
-	s := strconv.Itoa(val)
+// isSequence reports whether the digit string s is made up of some shorter
+// block repeated at least twice.
+func isSequence(s string) bool {
 	for sequenceLength := 1; sequenceLength <= len(s)/2; sequenceLength++ {
 		sequence := s[:sequenceLength]
 		matched := true
@@ -47,16 +77,28 @@ func isSequence(val int) bool {
 	return false
 }
 
-func part1(ranges []idRange) int {
-	total := 0
+func part1(ranges []idRange) *big.Int {
+	total := new(big.Int)
 	fmt.Println(ranges)
 	for _, r := range ranges {
-		for v := r.loPrefix; v <= r.hiPrefix; v++ {
-			vs := strconv.Itoa(v)
-			vv, _ := strconv.Atoi(vs + vs)
-			if r.inRange(vv) {
-				// fmt.Println("Found:", vv)
-				total += vv
+		for _, sub := range r.byDigitLength() {
+			loDigits := sub.lo.Text(sub.base)
+			hiDigits := sub.hi.Text(sub.base)
+			n := len(loDigits)
+			// an odd number of digits can't be a doubled sequence
+			if !isEven(n) {
+				continue
+			}
+			loPrefix := parseID(loDigits[:n/2], sub.base)
+			hiPrefix := parseID(hiDigits[:n/2], sub.base)
+			vv := new(big.Int)
+			for v := loPrefix; v.Cmp(hiPrefix) <= 0; v.Add(v, one) {
+				vs := v.Text(sub.base)
+				vv.SetString(vs+vs, sub.base)
+				if sub.inRange(vv) {
+					// fmt.Println("Found:", vv.Text(sub.base))
+					total.Add(total, vv)
+				}
 			}
 		}
 	}
@@ -64,13 +106,13 @@ func part1(ranges []idRange) int {
 	return total
 }
 
-func part2(ranges []idRange) int {
-	total := 0
+func part2(ranges []idRange) *big.Int {
+	total := new(big.Int)
 	for _, r := range ranges {
-		for v := r.lo; v <= r.hi; v++ {
-			if isSequence(v) {
-				// fmt.Println("Found:", v)
-				total += v
+		for v := new(big.Int).Set(r.lo); v.Cmp(r.hi) <= 0; v.Add(v, one) {
+			if isSequence(v.Text(r.base)) {
+				// fmt.Println("Found:", v.Text(r.base))
+				total.Add(total, v)
 			}
 		}
 	}
@@ -82,7 +124,33 @@ func isEven(n int) bool {
 	return n%2 == 0
 }
 
-func readRanges(filename string) []idRange {
+func parseID(s string, base int) *big.Int {
+	v, ok := new(big.Int).SetString(s, base)
+	if !ok {
+		log.Fatalf("Invalid base %d ID: %s", base, s)
+	}
+	return v
+}
+
+func parseRanges(data string, base int) []idRange {
+	pairs := strings.Split(data, ",")
+	pat := regexp.MustCompile(`([0-9A-Za-z]+)-([0-9A-Za-z]+)`)
+	var ranges []idRange
+	for _, pair := range pairs {
+		matches := pat.FindStringSubmatch(pair)
+		if matches == nil {
+			log.Fatalf("Invalid range: %q", pair)
+		}
+		ranges = append(ranges, idRange{
+			base: base,
+			lo:   parseID(matches[1], base),
+			hi:   parseID(matches[2], base),
+		})
+	}
+	return ranges
+}
+
+func readRanges(filename string, base int) []idRange {
 	f, err := os.Open(fmt.Sprintf("./data/%s.txt", filename))
 	if err != nil {
 		log.Fatal(err)
@@ -91,50 +159,39 @@ func readRanges(filename string) []idRange {
 	if err != nil {
 		log.Fatal(err)
 	}
-	pairs := strings.Split(string(b), ",")
-	var ranges []idRange
-	for _, pair := range pairs {
-		var r idRange
-		pat := regexp.MustCompile(`(\d+)-(\d+)`)
-		matches := pat.FindStringSubmatch(pair)
-		lo, _ := strconv.Atoi(matches[1])
-		hi, _ := strconv.Atoi(matches[2])
-		r.lo = lo
-		r.hi = hi
-		loLen := len(matches[1])
-		hiLen := len(matches[2])
-		var loPrefix, hiPrefix int
-		switch {
-		case !isEven(loLen) && isEven(hiLen):
-			loPrefix, _ = strconv.Atoi(matches[1][:loLen/2])
-			hiPrefix, _ = strconv.Atoi(matches[2][:hiLen/2])
-		default:
-			loPrefix, _ = strconv.Atoi(matches[1][:loLen-loLen/2])
-			hiPrefix, _ = strconv.Atoi(matches[2][:hiLen-hiLen/2])
-		}
-		r.loPrefix = loPrefix
-		r.hiPrefix = hiPrefix
-		ranges = append(ranges, r)
-	}
-	return ranges
+	return parseRanges(string(b), base)
 }
 
 func main() {
 	args := os.Args[1:]
 	filename := "sample"
-	if len(args) > 0 {
-		switch args[0] {
+	base := 10
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
 		case "sample", "input":
-			filename = args[0]
+			filename = args[i]
 		case "-s":
 			filename = "sample"
 		case "-i":
 			filename = "input"
+		case "--base", "-b":
+			i++
+			if i >= len(args) {
+				log.Fatalf("%s requires a value", args[i-1])
+			}
+			b, err := strconv.Atoi(args[i])
+			if err != nil || b < 2 || b > 36 {
+				log.Fatalf("Base must be between 2 and 36: %s", args[i])
+			}
+			base = b
 		default:
-			log.Fatalf("Unknown filename: %s", args[0])
+			if strings.HasPrefix(args[i], "-") {
+				log.Fatalf("Unknown option: %s", args[i])
+			}
+			filename = args[i]
 		}
 	}
-	ranges := readRanges(filename)
+	ranges := readRanges(filename, base)
 	fmt.Println(part1(ranges))
 	fmt.Println(part2(ranges))
 }
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+)
+
+// bruteDoubled sums every ID in the range whose digits are some block
+// repeated exactly twice, by checking each ID in turn.
+func bruteDoubled(r idRange) *big.Int {
+	total := new(big.Int)
+	for v := new(big.Int).Set(r.lo); v.Cmp(r.hi) <= 0; v.Add(v, one) {
+		s := v.Text(r.base)
+		if isEven(len(s)) && s[:len(s)/2] == s[len(s)/2:] {
+			total.Add(total, v)
+		}
+	}
+	return total
+}
+
+func Test_part1(t *testing.T) {
+	tests := []struct {
+		name   string // description of this test case
+		ranges string
+		base   int
+	}{
+		{name: "single digits", ranges: "1-9", base: 10},
+		{name: "one to two digits", ranges: "9-11", base: 10},
+		{name: "exact match", ranges: "11-11", base: 10},
+		{name: "no match", ranges: "12-21", base: 10},
+		{name: "two to three digits", ranges: "99-100", base: 10},
+		{name: "even to even across odd", ranges: "95-1012", base: 10},
+		{name: "odd to odd", ranges: "5-123", base: 10},
+		{name: "odd to odd across even", ranges: "123-45678", base: 10},
+		{name: "odd to even", ranges: "5-123456", base: 10},
+		{name: "many lengths", ranges: "1-1000000", base: 10},
+		{name: "even to even", ranges: "1010-999999", base: 10},
+		{name: "high prefix", ranges: "9899-100000", base: 10},
+		{name: "sample", ranges: "11-22,95-115,998-1012,1188511880-1188511890,222220-222224", base: 10},
+		{name: "binary", ranges: "1-11111111111", base: 2},
+		{name: "hex", ranges: "1-fffff", base: 16},
+		{name: "base 36", ranges: "z-zzz", base: 36},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ranges := parseRanges(tt.ranges, tt.base)
+			want := new(big.Int)
+			for _, r := range ranges {
+				want.Add(want, bruteDoubled(r))
+			}
+			got := part1(ranges)
+			if got.Cmp(want) != 0 {
+				t.Errorf("part1() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func Test_byDigitLength(t *testing.T) {
+	r := parseRanges("5-123456", 10)[0]
+	want := []string{"5-9", "10-99", "100-999", "1000-9999", "10000-99999", "100000-123456"}
+	got := r.byDigitLength()
+	if len(got) != len(want) {
+		t.Fatalf("byDigitLength() returned %d ranges, want %d", len(got), len(want))
+	}
+	for i, sub := range got {
+		if s := sub.lo.String() + "-" + sub.hi.String(); s != want[i] {
+			t.Errorf("byDigitLength()[%d] = %s, want %s", i, s, want[i])
+		}
+	}
+}
+
+func Test_parseRanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		ranges string
+		base   int
+		lo, hi string // in base 10
+		part1  string
+	}{
+		{name: "hex", ranges: "abaa-abac", base: 16, lo: "43946", hi: "43948", part1: "43947"},
+		{name: "binary", ranges: "1000-1111", base: 2, lo: "8", hi: "15", part1: "25"},
+		{name: "beyond int64", ranges: "12345678901234567891-12345678901234567899", base: 10,
+			lo: "12345678901234567891", hi: "12345678901234567899", part1: "0"},
+		{name: "doubled beyond int64", ranges: "1234567890123412345678901234-1234567890123412345678901234", base: 10,
+			lo: "1234567890123412345678901234", hi: "1234567890123412345678901234", part1: "1234567890123412345678901234"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ranges := parseRanges(tt.ranges, tt.base)
+			if len(ranges) != 1 || ranges[0].lo.String() != tt.lo || ranges[0].hi.String() != tt.hi {
+				t.Fatalf("parseRanges(%q, %d) = %v, want %s-%s", tt.ranges, tt.base, ranges, tt.lo, tt.hi)
+			}
+			if got := part1(ranges).String(); got != tt.part1 {
+				t.Errorf("part1() = %s, want %s", got, tt.part1)
+			}
+		})
+	}
+}
@@ -1,40 +1,251 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math/big"
 	"os"
-	"sort"
 	"strconv"
 	"strings"
 )
 
-// algorithm: find first max character in a string not including the last
-// character -- and its position, which must be at least n digits from the end.
-// Then find the next max character after that position. If we ever run out of
-// string, just take whatever is left. Repeat until we have n digits.
-func solve(lines []string, numdigits int) int {
-	total := 0
-	// BUG can't truncate to less than n digits
-	for _, line := range lines {
-		digits := ""
-		for n := numdigits - 1; n >= 0; n-- {
-			if len(line) <= n {
-				digits += line
-				break
+var (
+	errShortLine  = errors.New("line has fewer digits than requested")
+	errNoSolution = errors.New("no selection satisfies the objective")
+)
+
+type objectiveKind int
+
+const (
+	// the largest k-digit number
+	maximum objectiveKind = iota
+	// the smallest k-digit number without a leading zero
+	minimum
+	// the largest k-digit number where chosen batteries are at least gap apart
+	spaced
+	// the largest k-digit number using batteries from at most window
+	// consecutive positions
+	windowed
+)
+
+type objective struct {
+	kind   objectiveKind
+	gap    int
+	window int
+}
+
+func checkDigits(line string) error {
+	for i := 0; i < len(line); i++ {
+		if line[i] < '0' || line[i] > '9' {
+			return fmt.Errorf("invalid digit %q in %q", line[i], line)
+		}
+	}
+	return nil
+}
+
+// algorithm: walk the line keeping a stack of chosen positions. Whenever the
+// next digit beats the top of the stack and we can still afford to drop
+// digits, pop the top -- a better digit earlier always wins. Whatever is left
+// in the first k slots of the stack is the best k-digit subsequence. This is
+// O(n) per line. better says whether digit a should replace digit b.
+func stackSelect(line string, offset int, k int, better func(a, b byte) bool) []int {
+	drop := len(line) - k
+	stack := make([]int, 0, len(line))
+	for i := 0; i < len(line); i++ {
+		for drop > 0 && len(stack) > 0 && better(line[i], line[stack[len(stack)-1]-offset]) {
+			stack = stack[:len(stack)-1]
+			drop--
+		}
+		stack = append(stack, i+offset)
+	}
+	return stack[:k]
+}
+
+func greater(a, b byte) bool { return a > b }
+func less(a, b byte) bool    { return a < b }
+
+// selectMin picks the smallest nonzero digit that still leaves room for k-1
+// more, then the smallest k-1 digits after it.
+func selectMin(line string, k int) ([]int, error) {
+	if k == 0 {
+		return nil, nil
+	}
+	first := -1
+	for i := 0; i <= len(line)-k; i++ {
+		if line[i] != '0' && (first < 0 || line[i] < line[first]) {
+			first = i
+		}
+	}
+	if first < 0 {
+		return nil, fmt.Errorf("%w: %q has no usable leading digit", errNoSolution, line)
+	}
+	rest := stackSelect(line[first+1:], first+1, k-1, less)
+	return append([]int{first}, rest...), nil
+}
+
+// selectSpaced chooses each digit greedily: the largest digit (leftmost if
+// tied) that is far enough from the previous one and still leaves room for
+// the rest. Taking the leftmost keeps the most options open. This is O(n*k).
+func selectSpaced(line string, k int, gap int) ([]int, error) {
+	if gap < 1 {
+		gap = 1
+	}
+	if k > 0 && len(line) < (k-1)*gap+1 {
+		return nil, fmt.Errorf("%w: %q is too short for %d digits %d apart", errNoSolution, line, k, gap)
+	}
+	positions := make([]int, 0, k)
+	start := 0
+	for n := k - 1; n >= 0; n-- {
+		best := start
+		for i := start; i < len(line)-n*gap; i++ {
+			if line[i] > line[best] {
+				best = i
+			}
+		}
+		positions = append(positions, best)
+		start = best + gap
+	}
+	return positions, nil
+}
+
+// selectWindowed tries the plain maximum in every window and keeps the best.
+// All candidates have k digits, so comparing them as strings is enough.
+func selectWindowed(line string, k int, window int) ([]int, error) {
+	if window > len(line) {
+		window = len(line)
+	}
+	if window < k {
+		return nil, fmt.Errorf("%w: window %d is smaller than %d digits", errNoSolution, window, k)
+	}
+	var best []int
+	bestDigits := ""
+	for start := 0; start+window <= len(line); start++ {
+		positions := stackSelect(line[start:start+window], start, k, greater)
+		if digits := digitsAt(line, positions); best == nil || digits > bestDigits {
+			best, bestDigits = positions, digits
+		}
+	}
+	return best, nil
+}
+
+// selectBatteries returns the positions of the k batteries in line that best
+// satisfy the objective, in increasing order.
+func selectBatteries(line string, k int, obj objective) ([]int, error) {
+	if len(line) < k {
+		return nil, fmt.Errorf("%w: %q has %d, want %d", errShortLine, line, len(line), k)
+	}
+	if err := checkDigits(line); err != nil {
+		return nil, err
+	}
+	switch obj.kind {
+	case minimum:
+		return selectMin(line, k)
+	case spaced:
+		return selectSpaced(line, k, obj.gap)
+	case windowed:
+		return selectWindowed(line, k, obj.window)
+	default:
+		return stackSelect(line, 0, k, greater), nil
+	}
+}
+
+func digitsAt(line string, positions []int) string {
+	digits := make([]byte, len(positions))
+	for i, p := range positions {
+		digits[i] = line[p]
+	}
+	return string(digits)
+}
+
+func joltage(digits string) *big.Int {
+	value := new(big.Int)
+	if digits != "" {
+		value.SetString(digits, 10)
+	}
+	return value
+}
+
+// maxJoltage returns the largest k-digit number that can be made from line.
+func maxJoltage(line string, k int) (string, *big.Int, error) {
+	positions, err := selectBatteries(line, k, objective{kind: maximum})
+	if err != nil {
+		return "", nil, err
+	}
+	digits := digitsAt(line, positions)
+	return digits, joltage(digits), nil
+}
+
+// bank is the result for one line of input: which batteries were turned on
+// and the joltage they produce.
+type bank struct {
+	line      string
+	positions []int
+	digits    string
+	value     *big.Int
+}
+
+// render returns the line with the chosen digits highlighted, in bold green
+// if color is set and in brackets otherwise.
+func (b bank) render(color bool) string {
+	var sb strings.Builder
+	next := 0
+	for i := 0; i < len(b.line); i++ {
+		if next < len(b.positions) && b.positions[next] == i {
+			next++
+			if color {
+				fmt.Fprintf(&sb, "\x1b[1;32m%c\x1b[0m", b.line[i])
+			} else {
+				fmt.Fprintf(&sb, "[%c]", b.line[i])
 			}
-			sorted := strings.Split(line[:len(line)-n], "")
-			sort.Strings(sorted)
-			maxdigit := sorted[len(sorted)-1]
-			p := strings.Index(line, maxdigit)
-			line = line[p+1:]
-			digits += maxdigit
+			continue
 		}
-		value, _ := strconv.Atoi(digits)
-		total += value
+		sb.WriteByte(b.line[i])
 	}
-	return total
+	return sb.String()
+}
+
+// explain works out the selection for every bank, so we can see why a total
+// came out the way it did.
+func explain(lines []string, numdigits int, obj objective) ([]bank, error) {
+	var banks []bank
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+		positions, err := selectBatteries(line, numdigits, obj)
+		if err != nil {
+			return nil, err
+		}
+		digits := digitsAt(line, positions)
+		banks = append(banks, bank{
+			line:      line,
+			positions: positions,
+			digits:    digits,
+			value:     joltage(digits),
+		})
+	}
+	return banks, nil
+}
+
+func solve(lines []string, numdigits int, obj objective) (*big.Int, error) {
+	banks, err := explain(lines, numdigits, obj)
+	if err != nil {
+		return nil, err
+	}
+	total := new(big.Int)
+	for _, b := range banks {
+		total.Add(total, b.value)
+	}
+	return total, nil
+}
+
+// isTerminal reports whether stdout looks like a terminal, so we only emit
+// color escapes when someone is there to see them.
+func isTerminal() bool {
+	fi, err := os.Stdout.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
 }
 
 func readlines(filename string) []string {
@@ -52,19 +263,56 @@ func readlines(filename string) []string {
 func main() {
 	args := os.Args[1:]
 	filename := "sample"
-	if len(args) > 0 {
-		switch args[0] {
+	obj := objective{kind: maximum}
+	verbose := false
+	intArg := func(i int) int {
+		if i >= len(args) {
+			log.Fatalf("%s requires a value", args[i-1])
+		}
+		n, err := strconv.Atoi(args[i])
+		if err != nil || n < 1 {
+			log.Fatalf("%s must be a positive integer: %s", args[i-1], args[i])
+		}
+		return n
+	}
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
 		case "sample", "input":
-			filename = args[0]
+			filename = args[i]
 		case "-s":
 			filename = "sample"
 		case "-i":
 			filename = "input"
+		case "-v", "--explain":
+			verbose = true
+		case "--min":
+			obj = objective{kind: minimum}
+		case "--gap":
+			i++
+			obj = objective{kind: spaced, gap: intArg(i)}
+		case "--window":
+			i++
+			obj = objective{kind: windowed, window: intArg(i)}
 		default:
-			log.Fatalf("Unknown filename: %s", args[0])
+			log.Fatalf("Unknown filename: %s", args[i])
 		}
 	}
 	lines := readlines(filename)
-	fmt.Println(solve(lines, 2))
-	fmt.Println(solve(lines, 12))
+	color := isTerminal()
+	for _, numdigits := range []int{2, 12} {
+		if verbose {
+			banks, err := explain(lines, numdigits, obj)
+			if err != nil {
+				log.Fatal(err)
+			}
+			for i, b := range banks {
+				fmt.Printf("%4d %s  %v  %s\n", i+1, b.render(color), b.positions, b.digits)
+			}
+		}
+		total, err := solve(lines, numdigits, obj)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(total)
+	}
 }
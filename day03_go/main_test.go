@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"math/rand/v2"
+	"testing"
+)
+
+func Test_maxJoltage(t *testing.T) {
+	tests := []struct {
+		name    string // description of this test case
+		line    string
+		k       int
+		want    string
+		wantErr error
+	}{
+		{name: "sample1", line: "987654321111111", k: 2, want: "98"},
+		{name: "sample2", line: "811111111111119", k: 2, want: "89"},
+		{name: "sample3", line: "234234234234278", k: 12, want: "434234234278"},
+		{name: "sample4", line: "818181911112111", k: 12, want: "888911112111"},
+		{name: "whole line", line: "12345", k: 5, want: "12345"},
+		{name: "no digits", line: "12345", k: 0, want: ""},
+		{name: "more than 18 digits", line: "99999999999999999999999", k: 20, want: "99999999999999999999"},
+		{name: "short line", line: "123", k: 4, wantErr: errShortLine},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, value, err := maxJoltage(tt.line, tt.k)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("maxJoltage() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got != tt.want {
+				t.Errorf("maxJoltage() = %v, want %v", got, tt.want)
+			}
+			if tt.k > 0 && value.String() != tt.want {
+				t.Errorf("maxJoltage() value = %v, want %v", value, tt.want)
+			}
+		})
+	}
+}
+
+// bruteSelect tries every k-subset of positions in line and returns the best
+// digit string allowed by the objective, or "" with ok false if none is.
+func bruteSelect(line string, k int, obj objective) (best string, ok bool) {
+	var try func(start int, chosen []int)
+	try = func(start int, chosen []int) {
+		if len(chosen) == k {
+			if !allowed(line, chosen, obj) {
+				return
+			}
+			digits := digitsAt(line, chosen)
+			if !ok || (obj.kind == minimum && digits < best) || (obj.kind != minimum && digits > best) {
+				best, ok = digits, true
+			}
+			return
+		}
+		for i := start; i < len(line); i++ {
+			try(i+1, append(chosen, i))
+		}
+	}
+	try(0, nil)
+	return best, ok
+}
+
+func allowed(line string, chosen []int, obj objective) bool {
+	switch obj.kind {
+	case minimum:
+		return len(chosen) == 0 || line[chosen[0]] != '0'
+	case spaced:
+		for i := 1; i < len(chosen); i++ {
+			if chosen[i]-chosen[i-1] < obj.gap {
+				return false
+			}
+		}
+	case windowed:
+		return len(chosen) == 0 || chosen[len(chosen)-1]-chosen[0] < obj.window
+	}
+	return true
+}
+
+func Test_selectBatteries(t *testing.T) {
+	objectives := []objective{
+		{kind: maximum},
+		{kind: minimum},
+		{kind: spaced, gap: 1},
+		{kind: spaced, gap: 2},
+		{kind: spaced, gap: 3},
+		{kind: windowed, window: 3},
+		{kind: windowed, window: 5},
+	}
+	rng := rand.New(rand.NewPCG(3, 2025))
+	for n := 1; n <= 9; n++ {
+		for trial := 0; trial < 40; trial++ {
+			digits := make([]byte, n)
+			for i := range digits {
+				// keep the alphabet small so there are lots of ties and zeros
+				digits[i] = byte('0' + rng.IntN(4))
+			}
+			line := string(digits)
+			for k := 0; k <= n; k++ {
+				for _, obj := range objectives {
+					want, ok := bruteSelect(line, k, obj)
+					positions, err := selectBatteries(line, k, obj)
+					if !ok {
+						if !errors.Is(err, errNoSolution) {
+							t.Errorf("selectBatteries(%q, %d, %+v) error = %v, want %v", line, k, obj, err, errNoSolution)
+						}
+						continue
+					}
+					if err != nil {
+						t.Errorf("selectBatteries(%q, %d, %+v) error = %v", line, k, obj, err)
+						continue
+					}
+					if !allowed(line, positions, obj) {
+						t.Errorf("selectBatteries(%q, %d, %+v) = %v, which breaks the objective", line, k, obj, positions)
+					}
+					if got := digitsAt(line, positions); got != want {
+						t.Errorf("selectBatteries(%q, %d, %+v) = %q, want %q", line, k, obj, got, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+func Test_bankRender(t *testing.T) {
+	b := bank{line: "811111111111119", positions: []int{0, 14}}
+	if got, want := b.render(false), "[8]1111111111111[9]"; got != want {
+		t.Errorf("render(false) = %q, want %q", got, want)
+	}
+	if got, want := b.render(true), "\x1b[1;32m8\x1b[0m1111111111111\x1b[1;32m9\x1b[0m"; got != want {
+		t.Errorf("render(true) = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// history records how a grid was peeled: what it looked like to begin with,
+// which cells were removed in each round, and the rolls that never were. With
+// an update policy other than synchronous, a round is one pass over the grid.
+type history struct {
+	rule    rule
+	initial [][]byte
+	rounds  [][][2]int
+	// layers holds the round (starting at 1) in which each roll was removed,
+	// or 0 if it was never removed.
+	layers [][]int
+	core   [][2]int
+}
+
+func copyGrid(grid [][]byte) [][]byte {
+	dup := make([][]byte, len(grid))
+	for r := range grid {
+		dup[r] = slices.Clone(grid[r])
+	}
+	return dup
+}
+
+// newHistory peels the grid (which is left in its final state) and records
+// everything that happened along the way.
+func newHistory(lines [][]byte, ru rule, up update) history {
+	h := history{rule: ru, initial: copyGrid(lines)}
+	h.rounds = up.remove(lines, ru)
+	h.layers = make([][]int, len(lines))
+	for r := range lines {
+		h.layers[r] = make([]int, len(lines[r]))
+	}
+	for round, cells := range h.rounds {
+		for _, rc := range cells {
+			h.layers[rc[0]][rc[1]] = round + 1
+		}
+	}
+	for r := range h.initial {
+		for c := range h.initial[r] {
+			if h.rule.removable[h.initial[r][c]] && h.layers[r][c] == 0 {
+				h.core = append(h.core, [2]int{r, c})
+			}
+		}
+	}
+	return h
+}
+
+// layerGrid renders the round each roll was removed in. Cells that were never
+// removed, including the stable core, keep their original character. If there
+// are more than 9 rounds, every cell is padded to the same width and separated
+// by spaces.
+func (h history) layerGrid() string {
+	width := len(strconv.Itoa(len(h.rounds)))
+	var sb strings.Builder
+	for r := range h.initial {
+		for c := range h.initial[r] {
+			if c > 0 && width > 1 {
+				sb.WriteByte(' ')
+			}
+			cell := string(h.initial[r][c])
+			if h.layers[r][c] > 0 {
+				cell = strconv.Itoa(h.layers[r][c])
+			}
+			fmt.Fprintf(&sb, "%*s", width, cell)
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// frame returns the grid as it was after the given number of rounds.
+func (h history) frame(round int) [][]byte {
+	grid := copyGrid(h.initial)
+	for _, cells := range h.rounds[:round] {
+		for _, rc := range cells {
+			grid[rc[0]][rc[1]] = h.rule.empty
+		}
+	}
+	return grid
+}
+
+var gifPalette = color.Palette{
+	color.White,
+	color.RGBA{0x40, 0x40, 0x40, 0xff}, // rolls
+	color.RGBA{0xe0, 0x30, 0x30, 0xff}, // rolls removed in this round
+	color.RGBA{0xa0, 0xa0, 0xc0, 0xff}, // anything else that isn't empty
+}
+
+// writeGIF writes an animation of the grid being peeled, one frame per round,
+// with each cell drawn as a scale x scale square. The rolls removed in a
+// round are shown in red in that round's frame.
+func (h history) writeGIF(w io.Writer, scale int) error {
+	width := 0
+	for _, row := range h.initial {
+		width = max(width, len(row))
+	}
+	bounds := image.Rect(0, 0, width*scale, len(h.initial)*scale)
+	anim := &gif.GIF{}
+	for round := 0; round <= len(h.rounds); round++ {
+		img := image.NewPaletted(bounds, gifPalette)
+		fill := func(r, c int, idx uint8) {
+			for y := r * scale; y < (r+1)*scale; y++ {
+				for x := c * scale; x < (c+1)*scale; x++ {
+					img.SetColorIndex(x, y, idx)
+				}
+			}
+		}
+		for r, row := range h.frame(round) {
+			for c, cell := range row {
+				switch {
+				case h.rule.removable[cell]:
+					fill(r, c, 1)
+				case cell != h.rule.empty:
+					fill(r, c, 3)
+				}
+			}
+		}
+		if round > 0 {
+			for _, rc := range h.rounds[round-1] {
+				fill(rc[0], rc[1], 2)
+			}
+		}
+		anim.Image = append(anim.Image, img)
+		anim.Delay = append(anim.Delay, 20)
+	}
+	// linger on the stable core before looping
+	anim.Delay[len(anim.Delay)-1] = 200
+	return gif.EncodeAll(w, anim)
+}
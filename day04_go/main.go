@@ -2,35 +2,31 @@ package main
 
 import (
 	"bytes"
+	"cmp"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"slices"
+	"strconv"
 )
 
-func countNeighbors(grid [][]byte, row, col int) int {
+func countNeighbors(grid [][]byte, ru rule, row, col int) int {
 	count := 0
-	directions := [8][2]int{
-		{-1, -1}, {-1, 0}, {-1, 1},
-		{0, -1} /*******/, {0, 1},
-		{1, -1}, {1, 0}, {1, 1},
-	}
-	for _, dir := range directions {
-		r, c := row+dir[0], col+dir[1]
-		if r >= 0 && r < len(grid) && c >= 0 && c < len(grid[row]) {
-			if grid[r][c] == '@' {
-				count++
-			}
+	for _, d := range ru.stencil {
+		if r, c, ok := ru.neighbor(grid, row, col, d); ok && ru.counted[grid[r][c]] {
+			count++
 		}
 	}
 	return count
 }
 
-func countRolls(grid [][]byte) int {
+// countRolls counts the cells the rule is able to remove.
+func countRolls(grid [][]byte, ru rule) int {
 	count := 0
 	for r := range len(grid) {
 		for c := range len(grid[r]) {
-			if grid[r][c] == '@' {
+			if ru.removable[grid[r][c]] {
 				count++
 			}
 		}
@@ -38,27 +34,15 @@ func countRolls(grid [][]byte) int {
 	return count
 }
 
-func part1(lines [][]byte) int {
-	total := 0
-	for r := range len(lines) {
-		for c := range len(lines[r]) {
-			neighbors := countNeighbors(lines, r, c)
-			// fmt.Print(neighbors)
-			if lines[r][c] == '@' && neighbors < 4 {
-				total++
-			}
-		}
-		// fmt.Println()
-	}
-	return total
+func part1(lines [][]byte, ru rule) int {
+	return len(findRemoveables(lines, ru))
 }
 
-func findRemoveables(lines [][]byte) [][2]int {
+func findRemoveables(lines [][]byte, ru rule) [][2]int {
 	var removeables [][2]int
 	for r := range len(lines) {
 		for c := range len(lines[r]) {
-			neighbors := countNeighbors(lines, r, c)
-			if lines[r][c] == '@' && neighbors < 4 {
+			if ru.removable[lines[r][c]] && countNeighbors(lines, ru, r, c) < ru.threshold {
 				removeables = append(removeables, [2]int{r, c})
 			}
 		}
@@ -66,29 +50,138 @@ func findRemoveables(lines [][]byte) [][2]int {
 	return removeables
 }
 
-func part2(lines [][]byte) int {
-	rounds := 0
-	rolls := countRolls(lines)
-	fmt.Println("Initial rolls:", rolls)
+// removeByRounds rescans the whole grid every round, removing everything
+// that's removable all at once. It returns the cells removed in each round.
+func removeByRounds(lines [][]byte, ru rule) [][][2]int {
+	var removed [][][2]int
 	for {
-		removeables := findRemoveables(lines)
+		removeables := findRemoveables(lines, ru)
 		if len(removeables) == 0 {
 			break
 		}
-		fmt.Println("Removing:", len(removeables))
 		for _, rc := range removeables {
-			lines[rc[0]][rc[1]] = '.'
+			lines[rc[0]][rc[1]] = ru.empty
+		}
+		removed = append(removed, removeables)
+	}
+	return removed
+}
+
+// removeByWorklist removes rolls in exactly the same rounds as
+// removeByRounds, but it counts neighbors once up front and then only
+// re-examines the neighbors of rolls that were just removed. A roll can only
+// become removable when one of its neighbors goes away, so that's all we need
+// to look at. It returns the cells removed in each round, in reading order.
+// This only works for monotone rules.
+func removeByWorklist(lines [][]byte, ru rule) [][][2]int {
+	counts := make([][]int, len(lines))
+	queued := make([][]bool, len(lines))
+	var current [][2]int
+	for r := range len(lines) {
+		counts[r] = make([]int, len(lines[r]))
+		queued[r] = make([]bool, len(lines[r]))
+		for c := range len(lines[r]) {
+			if !ru.removable[lines[r][c]] {
+				continue
+			}
+			counts[r][c] = countNeighbors(lines, ru, r, c)
+			if counts[r][c] < ru.threshold {
+				queued[r][c] = true
+				current = append(current, [2]int{r, c})
+			}
 		}
-		rounds++
 	}
-	remaining := countRolls(lines)
+
+	var removed [][][2]int
+	for len(current) > 0 {
+		// only cells that were counted make a difference to their neighbors
+		var dropped [][2]int
+		for _, rc := range current {
+			if ru.counted[lines[rc[0]][rc[1]]] {
+				dropped = append(dropped, rc)
+			}
+			lines[rc[0]][rc[1]] = ru.empty
+		}
+		slices.SortFunc(current, func(a, b [2]int) int {
+			return cmp.Or(cmp.Compare(a[0], b[0]), cmp.Compare(a[1], b[1]))
+		})
+		removed = append(removed, current)
+		var next [][2]int
+		for _, rc := range dropped {
+			// the cells whose stencil includes a removed cell are the ones at
+			// the negated offsets, and those are the counts that drop
+			for _, d := range ru.stencil {
+				r, c, ok := ru.neighbor(lines, rc[0], rc[1], [2]int{-d[0], -d[1]})
+				if !ok || !ru.removable[lines[r][c]] {
+					continue
+				}
+				counts[r][c]--
+				if counts[r][c] < ru.threshold && !queued[r][c] {
+					queued[r][c] = true
+					next = append(next, [2]int{r, c})
+				}
+			}
+		}
+		current = next
+	}
+	return removed
+}
+
+func part2(lines [][]byte, ru rule, up update) int {
+	rolls := countRolls(lines, ru)
+	fmt.Println("Initial rolls:", rolls)
+	for _, cells := range up.remove(lines, ru) {
+		fmt.Println("Removing:", len(cells))
+	}
+	remaining := countRolls(lines, ru)
 	fmt.Println("Remaining rolls:", remaining)
 	removed := rolls - remaining
 	fmt.Println("Total removed:", removed)
 	return removed
 }
 
-func readlines(filename string) [][]byte {
+// part2Sparse is part2 for sparse grids.
+func part2Sparse(g *sparseGrid, ru rule) int {
+	rolls := g.countRolls(ru)
+	fmt.Println("Initial rolls:", rolls)
+	rounds, err := g.peel(ru)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, cells := range rounds {
+		fmt.Println("Removing:", len(cells))
+	}
+	remaining := g.countRolls(ru)
+	fmt.Println("Remaining rolls:", remaining)
+	removed := rolls - remaining
+	fmt.Println("Total removed:", removed)
+	return removed
+}
+
+// parseGrid splits the input into rows, dropping a trailing newline (and any
+// carriage returns). Every row has to be the same length and made of visible
+// characters, so the solvers never have to deal with ragged or funky rows.
+func parseGrid(b []byte) ([][]byte, error) {
+	b = bytes.ReplaceAll(b, []byte("\r\n"), []byte("\n"))
+	b = bytes.TrimSuffix(b, []byte("\n"))
+	if len(b) == 0 {
+		return nil, nil
+	}
+	lines := bytes.Split(b, []byte("\n"))
+	for r, line := range lines {
+		if len(line) != len(lines[0]) {
+			return nil, fmt.Errorf("row %d has %d cells, want %d", r+1, len(line), len(lines[0]))
+		}
+		for c, ch := range line {
+			if ch <= ' ' || ch > '~' {
+				return nil, fmt.Errorf("row %d col %d: invalid cell %q", r+1, c+1, ch)
+			}
+		}
+	}
+	return lines, nil
+}
+
+func readfile(filename string) []byte {
 	f, err := os.Open(fmt.Sprintf("./data/%s.txt", filename))
 	if err != nil {
 		log.Fatal(err)
@@ -97,27 +190,144 @@ func readlines(filename string) [][]byte {
 	if err != nil {
 		log.Fatal(err)
 	}
-	lines := bytes.Split(b, []byte("\n"))
-	// assumes that there are no extra or funky characters in the input
+	return b
+}
+
+func readlines(filename string) [][]byte {
+	lines, err := parseGrid(readfile(filename))
+	if err != nil {
+		log.Fatalf("%s: %v", filename, err)
+	}
 	return lines
 }
 
 func main() {
 	args := os.Args[1:]
 	filename := "sample"
-	if len(args) > 0 {
-		switch args[0] {
+	showLayers := false
+	ru := defaultRule()
+	var up update
+	compare := false
+	sparse, coords := false, false
+	gifFile := ""
+	var i int
+	nextArg := func() string {
+		i++
+		if i >= len(args) {
+			log.Fatalf("%s requires a value", args[i-1])
+		}
+		return args[i]
+	}
+	for i = 0; i < len(args); i++ {
+		switch args[i] {
 		case "sample", "input":
-			filename = args[0]
+			filename = args[i]
 		case "-s":
 			filename = "sample"
 		case "-i":
 			filename = "input"
+		case "--moore":
+			ru.stencil = mooreStencil
+		case "--vonneumann":
+			ru.stencil = vonNeumannStencil
+		case "--stencil":
+			stencil, err := parseStencil(nextArg())
+			if err != nil {
+				log.Fatal(err)
+			}
+			ru.stencil = stencil
+		case "--threshold":
+			n, err := strconv.Atoi(nextArg())
+			if err != nil {
+				log.Fatalf("Invalid threshold: %v", err)
+			}
+			ru.threshold = n
+		case "--wrap":
+			ru.wrap = true
+		case "--removable":
+			ru.removable = cellSet(nextArg())
+		case "--counted":
+			ru.counted = cellSet(nextArg())
+		case "--policy":
+			p, err := parsePolicy(nextArg())
+			if err != nil {
+				log.Fatal(err)
+			}
+			up.policy = p
+		case "--seed":
+			seed, err := strconv.ParseUint(nextArg(), 10, 64)
+			if err != nil {
+				log.Fatalf("Invalid seed: %v", err)
+			}
+			up.seed = seed
+		case "--compare":
+			compare = true
+		case "--sparse":
+			sparse = true
+		case "--coords":
+			coords = true
+		case "--layers":
+			showLayers = true
+		case "--gif":
+			gifFile = nextArg()
 		default:
-			log.Fatalf("Unknown filename: %s", args[0])
+			log.Fatalf("Unknown filename: %s", args[i])
+		}
+	}
+	if err := ru.validate(); err != nil {
+		log.Fatal(err)
+	}
+	if sparse || coords {
+		if showLayers || gifFile != "" || compare {
+			log.Fatal("--layers, --gif and --compare only work on dense grids")
 		}
+		if up.policy != synchronous {
+			log.Fatalf("the %s update policy only works on dense grids", up.policy)
+		}
+		var g *sparseGrid
+		if coords {
+			var err error
+			if g, err = parseCoords(readfile(filename)); err != nil {
+				log.Fatalf("%s: %v", filename, err)
+			}
+		} else {
+			g = sparseFromGrid(readlines(filename), ru.empty)
+		}
+		fmt.Println(len(g.findRemoveables(ru)))
+		fmt.Println(part2Sparse(g, ru))
+		return
 	}
+
 	lines := readlines(filename)
-	fmt.Println(part1(lines))
-	fmt.Println(part2(lines))
+	fmt.Println(part1(lines, ru))
+	fmt.Println(part2(lines, ru, up))
+
+	if compare {
+		results := comparePolicies(readlines(filename), ru, up.seed)
+		for _, res := range results {
+			fmt.Printf("%-12s passes %4d  removed %6d  remaining %6d  (%+d vs %s)\n",
+				res.update.policy, res.passes, res.removed, res.remaining,
+				res.remaining-results[0].remaining, results[0].update.policy)
+		}
+	}
+
+	if showLayers || gifFile != "" {
+		h := newHistory(readlines(filename), ru, up)
+		if showLayers {
+			fmt.Print(h.layerGrid())
+			fmt.Println("Core rolls:", len(h.core))
+		}
+		if gifFile != "" {
+			f, err := os.Create(gifFile)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if err := h.writeGIF(f, 4); err != nil {
+				log.Fatal(err)
+			}
+			if err := f.Close(); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
 }
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bytes"
+	"maps"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+// randomGrid makes a size x size grid where each cell is a roll with the
+// given probability.
+func randomGrid(size int, density float64, seed uint64) [][]byte {
+	return randomCells(size, size, map[byte]float64{'@': density}, seed)
+}
+
+// randomCells makes a rows x cols grid where each cell type appears with the
+// given probability, and the rest are empty.
+func randomCells(rows, cols int, probs map[byte]float64, seed uint64) [][]byte {
+	rng := rand.New(rand.NewPCG(seed, 4))
+	types := slices.Sorted(maps.Keys(probs))
+	grid := make([][]byte, rows)
+	for r := range grid {
+		grid[r] = bytes.Repeat([]byte("."), cols)
+		for c := range grid[r] {
+			p := rng.Float64()
+			for _, t := range types {
+				if p < probs[t] {
+					grid[r][c] = t
+					break
+				}
+				p -= probs[t]
+			}
+		}
+	}
+	return grid
+}
+
+func Test_removeByWorklist(t *testing.T) {
+	tests := []struct {
+		name string // description of this test case
+		grid [][]byte
+	}{
+		{name: "sample", grid: readlines("sample")},
+		{name: "empty", grid: [][]byte{[]byte("....")}},
+		{name: "sparse", grid: randomGrid(40, 0.3, 1)},
+		{name: "dense", grid: randomGrid(40, 0.75, 2)},
+		{name: "packed", grid: randomGrid(40, 0.95, 3)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := copyGrid(tt.grid)
+			wantRounds := removeByRounds(want, defaultRule())
+			got := copyGrid(tt.grid)
+			gotRounds := removeByWorklist(got, defaultRule())
+			if !slices.EqualFunc(gotRounds, wantRounds, slices.Equal) {
+				t.Errorf("removeByWorklist() rounds = %v, want %v", gotRounds, wantRounds)
+			}
+			if !slices.EqualFunc(got, want, bytes.Equal) {
+				t.Errorf("removeByWorklist() left a different grid than removeByRounds()")
+			}
+		})
+	}
+}
+
+func benchmarkRemove(b *testing.B, remove func([][]byte, rule) [][][2]int) {
+	grid := randomGrid(500, 0.75, 42)
+	for b.Loop() {
+		b.StopTimer()
+		g := copyGrid(grid)
+		b.StartTimer()
+		remove(g, defaultRule())
+	}
+}
+
+func Benchmark_removeByRounds(b *testing.B)   { benchmarkRemove(b, removeByRounds) }
+func Benchmark_removeByWorklist(b *testing.B) { benchmarkRemove(b, removeByWorklist) }
+
+func Test_newHistory(t *testing.T) {
+	for _, up := range []update{{policy: synchronous}, {policy: sequential}, {policy: randomOrder, seed: 1}} {
+		grid := readlines("sample")
+		rolls := countRolls(grid, defaultRule())
+		h := newHistory(grid, defaultRule(), up)
+		removed := 0
+		for r := range h.layers {
+			for c, layer := range h.layers[r] {
+				if layer > 0 {
+					removed++
+					if got := h.frame(layer - 1)[r][c]; got != '@' {
+						t.Errorf("%s: cell %d,%d removed in round %d was %q before it", up.policy, r, c, layer, got)
+					}
+					if got := h.frame(layer)[r][c]; got != '.' {
+						t.Errorf("%s: cell %d,%d removed in round %d was %q after it", up.policy, r, c, layer, got)
+					}
+				}
+			}
+		}
+		if removed != 43 || len(h.core) != rolls-43 {
+			t.Errorf("%s: newHistory() removed %d and kept %d, want 43 and %d", up.policy, removed, len(h.core), rolls-43)
+		}
+		if !slices.EqualFunc(h.frame(len(h.rounds)), grid, bytes.Equal) {
+			t.Errorf("%s: newHistory() final frame doesn't match the peeled grid", up.policy)
+		}
+		if want := len(up.remove(readlines("sample"), defaultRule())); len(h.rounds) != want {
+			t.Errorf("%s: newHistory() has %d rounds, want %d", up.policy, len(h.rounds), want)
+		}
+	}
+}
+
+func Test_rules(t *testing.T) {
+	custom := func(change func(ru *rule)) rule {
+		ru := defaultRule()
+		change(&ru)
+		return ru
+	}
+	knight, err := parseStencil("-2,-1 -2,1 -1,-2 -1,2 1,-2 1,2 2,-1 2,1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lopsided, err := parseStencil("0,1 0,2 1,1 2,-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string // description of this test case
+		rule rule
+		grid [][]byte
+	}{
+		{
+			name: "von neumann",
+			rule: custom(func(ru *rule) { ru.stencil, ru.threshold = vonNeumannStencil, 3 }),
+			grid: randomGrid(30, 0.8, 5),
+		},
+		{
+			name: "threshold 6",
+			rule: custom(func(ru *rule) { ru.threshold = 6 }),
+			grid: randomGrid(30, 0.8, 6),
+		},
+		{
+			name: "wraparound",
+			rule: custom(func(ru *rule) { ru.wrap = true }),
+			grid: randomCells(17, 23, map[byte]float64{'@': 0.7}, 7),
+		},
+		{
+			name: "knight",
+			rule: custom(func(ru *rule) { ru.stencil = knight }),
+			grid: randomGrid(30, 0.7, 8),
+		},
+		{
+			name: "lopsided wraparound",
+			rule: custom(func(ru *rule) { ru.stencil, ru.threshold, ru.wrap = lopsided, 3, true }),
+			grid: randomGrid(30, 0.7, 9),
+		},
+		{
+			name: "walls and ghosts",
+			rule: custom(func(ru *rule) {
+				// walls count as neighbors but never go away; ghosts go away
+				// but nobody notices
+				ru.removable = cellSet("@g")
+				ru.counted = cellSet("@#")
+			}),
+			grid: randomCells(30, 30, map[byte]float64{'@': 0.5, '#': 0.2, 'g': 0.1}, 10),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rule.validate(); err != nil {
+				t.Fatal(err)
+			}
+			want := copyGrid(tt.grid)
+			wantRounds := removeByRounds(want, tt.rule)
+			got := copyGrid(tt.grid)
+			gotRounds := removeByWorklist(got, tt.rule)
+			if len(wantRounds) < 2 {
+				t.Errorf("only %d rounds, the test grid is too boring", len(wantRounds))
+			}
+			if !slices.EqualFunc(gotRounds, wantRounds, slices.Equal) {
+				t.Errorf("removeByWorklist() rounds = %v, want %v", gotRounds, wantRounds)
+			}
+			if !slices.EqualFunc(got, want, bytes.Equal) {
+				t.Errorf("removeByWorklist() left a different grid than removeByRounds()")
+			}
+		})
+	}
+}
+
+func Test_comparePolicies(t *testing.T) {
+	crowded := defaultRule()
+	// a roll is removed if it has fewer than 3 empty neighbors, so removing
+	// one protects the rolls around it
+	crowded.counted = cellSet(".")
+	crowded.threshold = 3
+	tests := []struct {
+		name string // description of this test case
+		rule rule
+		grid [][]byte
+		want []int // remaining rolls for each policy
+	}{
+		{name: "sample", rule: defaultRule(), grid: readlines("sample"), want: []int{28, 28, 28}},
+		{name: "dense", rule: defaultRule(), grid: randomGrid(40, 0.75, 2)},
+		{name: "crowded", rule: crowded, grid: readlines("sample"), want: []int{20, 47, 50}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := comparePolicies(tt.grid, tt.rule, 1)
+			for i, res := range results {
+				if tt.want != nil && res.remaining != tt.want[i] {
+					t.Errorf("%s policy left %d, want %d", res.update.policy, res.remaining, tt.want[i])
+				}
+				// for monotone rules the order of removals doesn't matter
+				if tt.rule.monotone() && res.remaining != results[0].remaining {
+					t.Errorf("%s policy left %d, but synchronous left %d", res.update.policy, res.remaining, results[0].remaining)
+				}
+				if res.removed+res.remaining != countRolls(tt.grid, tt.rule) {
+					t.Errorf("%s policy removed %d and left %d from %d", res.update.policy, res.removed, res.remaining, countRolls(tt.grid, tt.rule))
+				}
+			}
+		})
+	}
+}
+
+func Test_parseGrid(t *testing.T) {
+	tests := []struct {
+		name    string // description of this test case
+		input   string
+		rows    int
+		wantErr bool
+	}{
+		{name: "trailing newline", input: "@.@\n.@.\n", rows: 2},
+		{name: "no trailing newline", input: "@.@\n.@.", rows: 2},
+		{name: "crlf", input: "@.@\r\n.@.\r\n", rows: 2},
+		{name: "empty", input: "", rows: 0},
+		{name: "ragged", input: "@.@\n.@\n", wantErr: true},
+		{name: "blank row", input: "@.@\n\n.@.\n", wantErr: true},
+		{name: "tab", input: "@.@\n.\t.\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseGrid([]byte(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseGrid() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && len(got) != tt.rows {
+				t.Errorf("parseGrid() returned %d rows, want %d", len(got), tt.rows)
+			}
+		})
+	}
+}
+
+func Test_sparseGrid(t *testing.T) {
+	wrap := defaultRule()
+	wrap.wrap = true
+	walls := defaultRule()
+	walls.removable = cellSet("@g")
+	walls.counted = cellSet("@#")
+	tests := []struct {
+		name string // description of this test case
+		rule rule
+		grid [][]byte
+	}{
+		{name: "sample", rule: defaultRule(), grid: readlines("sample")},
+		{name: "dense", rule: defaultRule(), grid: randomGrid(40, 0.75, 2)},
+		{name: "wraparound", rule: wrap, grid: randomCells(17, 23, map[byte]float64{'@': 0.7}, 7)},
+		{name: "walls", rule: walls, grid: randomCells(30, 30, map[byte]float64{'@': 0.5, '#': 0.2, 'g': 0.1}, 10)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := sparseFromGrid(tt.grid, tt.rule.empty)
+			if got, want := len(g.findRemoveables(tt.rule)), part1(tt.grid, tt.rule); got != want {
+				t.Errorf("findRemoveables() found %d, want %d", got, want)
+			}
+			dense := copyGrid(tt.grid)
+			want := removeByWorklist(dense, tt.rule)
+			got, err := g.peel(tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(want) {
+				t.Fatalf("peel() took %d rounds, want %d", len(got), len(want))
+			}
+			for i := range got {
+				if !slices.EqualFunc(got[i], want[i], func(p point, rc [2]int) bool {
+					return p == point{int64(rc[0]), int64(rc[1])}
+				}) {
+					t.Errorf("peel() round %d = %v, want %v", i+1, got[i], want[i])
+				}
+			}
+			if !maps.Equal(g.cells, sparseFromGrid(dense, tt.rule.empty).cells) {
+				t.Errorf("peel() left a different grid than removeByWorklist()")
+			}
+		})
+	}
+}
+
+func Test_parseCoords(t *testing.T) {
+	// a 2x2 block of rolls, far away from the origin, with one roll sitting
+	// on the far edge of the plane
+	input := "9000000000000000000,9000000000000000000\n" +
+		"9000000000000000000,9000000000000000001\n" +
+		"9000000000000000001,9000000000000000000\n" +
+		"9000000000000000001,9000000000000000001,#\n" +
+		"-9000000000000000000,0\n"
+	g, err := parseCoords([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ru := defaultRule()
+	ru.counted = cellSet("@#")
+	if got := g.countRolls(ru); got != 4 {
+		t.Errorf("countRolls() = %d, want 4", got)
+	}
+	rounds, err := g.peel(ru)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// everything goes in the first round, since nobody has 4 neighbors
+	if len(rounds) != 1 || len(rounds[0]) != 4 || len(g.cells) != 1 {
+		t.Errorf("peel() = %v, leaving %v", rounds, g.cells)
+	}
+
+	for _, bad := range []string{"1,2,3,4", "1", "a,b", "1,2\n1,2", "size 2,2\n5,5", ""} {
+		if _, err := parseCoords([]byte(bad)); err == nil {
+			t.Errorf("parseCoords(%q) succeeded, want an error", bad)
+		}
+	}
+}
+
+func Test_moveAlong(t *testing.T) {
+	// small axes, against plain modular arithmetic
+	for lo := int64(-3); lo <= 3; lo++ {
+		for hi := lo; hi <= lo+5; hi++ {
+			size := hi - lo + 1
+			for v := lo; v <= hi; v++ {
+				for d := -13; d <= 13; d++ {
+					n := v + int64(d)
+					got, ok := moveAlong(v, lo, hi, d, false)
+					if want := n >= lo && n <= hi; ok != want || (ok && got != n) {
+						t.Errorf("moveAlong(%d, %d, %d, %d) = %d, %v", v, lo, hi, d, got, ok)
+					}
+					want := lo + ((n-lo)%size+size)%size
+					if got, ok := moveAlong(v, lo, hi, d, true); !ok || got != want {
+						t.Errorf("moveAlong(%d, %d, %d, %d) with wrap = %d, %v, want %d", v, lo, hi, d, got, ok, want)
+					}
+				}
+			}
+		}
+	}
+
+	// axes too long for their span to fit in an int64
+	tests := []struct {
+		v, lo, hi int64
+		d         int
+		wrap      bool
+		want      int64
+		ok        bool
+	}{
+		{math.MaxInt64, math.MinInt64, math.MaxInt64, 1, true, math.MinInt64, true},
+		{math.MinInt64, math.MinInt64, math.MaxInt64, -2, true, math.MaxInt64 - 1, true},
+		{math.MaxInt64, math.MinInt64, math.MaxInt64, 1, false, 0, false},
+		{math.MinInt64, math.MinInt64, math.MaxInt64, -1, false, 0, false},
+		{0, math.MinInt64, math.MaxInt64, 5, false, 5, true},
+		{math.MaxInt64, -1, math.MaxInt64, 1, true, -1, true},
+		{-1, -1, math.MaxInt64, -3, true, math.MaxInt64 - 2, true},
+	}
+	for _, tt := range tests {
+		got, ok := moveAlong(tt.v, tt.lo, tt.hi, tt.d, tt.wrap)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("moveAlong(%d, %d, %d, %d, %v) = %d, %v, want %d, %v", tt.v, tt.lo, tt.hi, tt.d, tt.wrap, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	// a map that covers every row, with rolls at both ends that are
+	// neighbors once the rows wrap around
+	g, err := parseCoords([]byte("-9223372036854775808,0\n9223372036854775807,0\n0,9\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ru := defaultRule()
+	ru.wrap = true
+	if got := g.countNeighbors(ru, point{math.MaxInt64, 0}); got != 1 {
+		t.Errorf("countNeighbors() across the wrap = %d, want 1", got)
+	}
+}
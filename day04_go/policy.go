@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+)
+
+type policy int
+
+const (
+	// everything removable in a round is removed at once
+	synchronous policy = iota
+	// cells are removed one at a time while scanning in reading order, so a
+	// removal is seen by every cell after it in the same pass
+	sequential
+	// cells are removed one at a time in a random order
+	randomOrder
+)
+
+func (p policy) String() string {
+	switch p {
+	case sequential:
+		return "sequential"
+	case randomOrder:
+		return "random"
+	default:
+		return "synchronous"
+	}
+}
+
+func parsePolicy(s string) (policy, error) {
+	switch s {
+	case "sync", "synchronous":
+		return synchronous, nil
+	case "scan", "sequential":
+		return sequential, nil
+	case "random":
+		return randomOrder, nil
+	}
+	return 0, fmt.Errorf("unknown update policy: %s", s)
+}
+
+// update is how removals are applied; seed is only used for randomOrder.
+type update struct {
+	policy policy
+	seed   uint64
+}
+
+// remove peels the grid according to the update policy. It returns the cells
+// removed in each pass, in the order they were removed.
+func (up update) remove(lines [][]byte, ru rule) [][][2]int {
+	switch up.policy {
+	case sequential:
+		return removeSequentially(lines, ru, nil)
+	case randomOrder:
+		return removeSequentially(lines, ru, rand.New(rand.NewPCG(up.seed, 0)))
+	default:
+		return removeSynchronously(lines, ru)
+	}
+}
+
+// removeSynchronously uses the worklist when it can and falls back to
+// rescanning every round when it can't.
+func removeSynchronously(lines [][]byte, ru rule) [][][2]int {
+	if ru.monotone() {
+		return removeByWorklist(lines, ru)
+	}
+	return removeByRounds(lines, ru)
+}
+
+// removeSequentially makes passes over the grid, removing each cell the
+// moment it's found to be removable, until a pass removes nothing. Cells are
+// visited in reading order, or shuffled each pass if rng is set.
+func removeSequentially(lines [][]byte, ru rule, rng *rand.Rand) [][][2]int {
+	var cells [][2]int
+	for r := range len(lines) {
+		for c := range len(lines[r]) {
+			cells = append(cells, [2]int{r, c})
+		}
+	}
+	var removed [][][2]int
+	for {
+		if rng != nil {
+			rng.Shuffle(len(cells), func(i, j int) { cells[i], cells[j] = cells[j], cells[i] })
+		}
+		var pass [][2]int
+		for _, rc := range cells {
+			r, c := rc[0], rc[1]
+			if ru.removable[lines[r][c]] && countNeighbors(lines, ru, r, c) < ru.threshold {
+				lines[r][c] = ru.empty
+				pass = append(pass, rc)
+			}
+		}
+		if len(pass) == 0 {
+			return removed
+		}
+		removed = append(removed, pass)
+	}
+}
+
+type policyResult struct {
+	update    update
+	passes    int
+	removed   int
+	remaining int
+}
+
+// comparePolicies peels a copy of the grid with each update policy and
+// reports how many rolls are left. For monotone rules they always agree; it's
+// rules where empty cells are counted that make the order matter.
+func comparePolicies(lines [][]byte, ru rule, seed uint64) []policyResult {
+	var results []policyResult
+	for _, up := range []update{{policy: synchronous}, {policy: sequential}, {policy: randomOrder, seed: seed}} {
+		grid := copyGrid(lines)
+		passes := up.remove(grid, ru)
+		res := policyResult{update: up, passes: len(passes), remaining: countRolls(grid, ru)}
+		for _, cells := range passes {
+			res.removed += len(cells)
+		}
+		results = append(results, res)
+	}
+	return results
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// rule is the cellular-automaton rule that decides which cells get removed:
+// a cell of a removable type goes away when fewer than threshold of the
+// cells in its stencil are of a counted type. Removed cells become empty.
+type rule struct {
+	stencil   [][2]int
+	threshold int
+	wrap      bool
+	removable [256]bool
+	counted   [256]bool
+	empty     byte
+}
+
+var mooreStencil = [][2]int{
+	{-1, -1}, {-1, 0}, {-1, 1},
+	{0, -1} /*******/, {0, 1},
+	{1, -1}, {1, 0}, {1, 1},
+}
+
+var vonNeumannStencil = [][2]int{{-1, 0}, {0, -1}, {0, 1}, {1, 0}}
+
+// defaultRule is the puzzle's rule: a roll with fewer than 4 rolls among its
+// 8 neighbors can be removed.
+func defaultRule() rule {
+	r := rule{stencil: mooreStencil, threshold: 4, empty: '.'}
+	r.removable['@'] = true
+	r.counted['@'] = true
+	return r
+}
+
+// parseStencil reads a custom stencil written as space-separated "dr,dc"
+// offsets, like "-1,0 1,0 0,-2 0,2".
+func parseStencil(s string) ([][2]int, error) {
+	var stencil [][2]int
+	for _, field := range strings.Fields(s) {
+		dr, dc, ok := strings.Cut(field, ",")
+		if !ok {
+			return nil, fmt.Errorf("invalid stencil offset %q", field)
+		}
+		r, err := strconv.Atoi(dr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stencil offset %q: %w", field, err)
+		}
+		c, err := strconv.Atoi(dc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stencil offset %q: %w", field, err)
+		}
+		if r == 0 && c == 0 {
+			return nil, errors.New("a cell can't be its own neighbor")
+		}
+		stencil = append(stencil, [2]int{r, c})
+	}
+	if len(stencil) == 0 {
+		return nil, errors.New("empty stencil")
+	}
+	return stencil, nil
+}
+
+// cellSet turns a string of cell characters into a lookup table.
+func cellSet(chars string) [256]bool {
+	var set [256]bool
+	for i := 0; i < len(chars); i++ {
+		set[chars[i]] = true
+	}
+	return set
+}
+
+// validate checks the rule for combinations the solvers can't handle. If
+// empty cells could be removed we'd never finish.
+func (ru rule) validate() error {
+	if len(ru.stencil) == 0 {
+		return errors.New("empty stencil")
+	}
+	if ru.removable[ru.empty] {
+		return fmt.Errorf("empty cell %q can't be removable", ru.empty)
+	}
+	return nil
+}
+
+// monotone reports whether removing a cell can only ever make its neighbors
+// easier to remove, which is true as long as empty cells aren't counted. For
+// monotone rules the final grid doesn't depend on the order of removals, and
+// the worklist solver can be used.
+func (ru rule) monotone() bool {
+	return !ru.counted[ru.empty]
+}
+
+// neighbor returns the cell at the given offset from row, col, wrapping
+// around the edges if the rule says to. ok is false if it's off the grid.
+func (ru rule) neighbor(grid [][]byte, row, col int, d [2]int) (r, c int, ok bool) {
+	r, c = row+d[0], col+d[1]
+	if ru.wrap {
+		if len(grid) == 0 {
+			return 0, 0, false
+		}
+		r = (r%len(grid) + len(grid)) % len(grid)
+		if len(grid[r]) == 0 {
+			return 0, 0, false
+		}
+		c = (c%len(grid[r]) + len(grid[r])) % len(grid[r])
+		return r, c, true
+	}
+	return r, c, r >= 0 && r < len(grid) && c >= 0 && c < len(grid[r])
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// point is a cell position. Coordinates are 64-bit so that maps can be far
+// bigger than anything we could hold as [][]byte.
+type point struct {
+	r, c int64
+}
+
+func comparePoints(a, b point) int {
+	return cmp.Or(cmp.Compare(a.r, b.r), cmp.Compare(a.c, b.c))
+}
+
+// sparseGrid only stores the cells that aren't empty, which is all we need for
+// huge maps that are mostly empty. The bounds are inclusive and mark the edge
+// of the map; anything outside them is off the grid rather than empty.
+type sparseGrid struct {
+	min, max point
+	cells    map[point]byte
+}
+
+func sparseFromGrid(grid [][]byte, empty byte) *sparseGrid {
+	g := &sparseGrid{cells: make(map[point]byte)}
+	g.max = point{int64(len(grid)) - 1, -1}
+	for r := range grid {
+		g.max.c = max(g.max.c, int64(len(grid[r]))-1)
+		for c, ch := range grid[r] {
+			if ch != empty {
+				g.cells[point{int64(r), int64(c)}] = ch
+			}
+		}
+	}
+	return g
+}
+
+// parseCoords reads a map written as one cell per line, either "r,c" for a
+// roll or "r,c,X" for a cell of type X. The bounds are the smallest box around
+// all the cells, unless the first line is "size rows,cols".
+func parseCoords(b []byte) (*sparseGrid, error) {
+	g := &sparseGrid{cells: make(map[point]byte)}
+	sized := false
+	for i, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if size, ok := strings.CutPrefix(line, "size "); ok && i == 0 {
+			rows, cols, err := parsePair(size)
+			if err != nil || rows < 1 || cols < 1 {
+				return nil, fmt.Errorf("line %d: invalid size %q", i+1, size)
+			}
+			g.max = point{rows - 1, cols - 1}
+			sized = true
+			continue
+		}
+		fields := strings.Split(line, ",")
+		ch := byte('@')
+		switch {
+		case len(fields) == 3 && len(fields[2]) == 1 && fields[2][0] > ' ' && fields[2][0] <= '~':
+			ch = fields[2][0]
+		case len(fields) != 2:
+			return nil, fmt.Errorf("line %d: want r,c or r,c,X, got %q", i+1, line)
+		}
+		r, c, err := parsePair(fields[0] + "," + fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		p := point{r, c}
+		if _, ok := g.cells[p]; ok {
+			return nil, fmt.Errorf("line %d: %d,%d is listed twice", i+1, r, c)
+		}
+		if sized && (r < 0 || r > g.max.r || c < 0 || c > g.max.c) {
+			return nil, fmt.Errorf("line %d: %d,%d is outside the map", i+1, r, c)
+		}
+		if !sized {
+			if len(g.cells) == 0 {
+				g.min, g.max = p, p
+			}
+			g.min = point{min(g.min.r, r), min(g.min.c, c)}
+			g.max = point{max(g.max.r, r), max(g.max.c, c)}
+		}
+		g.cells[p] = ch
+	}
+	if !sized && len(g.cells) == 0 {
+		return nil, errors.New("no cells in map")
+	}
+	return g, nil
+}
+
+func parsePair(s string) (int64, int64, error) {
+	a, b, ok := strings.Cut(s, ",")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid coordinates %q", s)
+	}
+	r, err := strconv.ParseInt(strings.TrimSpace(a), 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid coordinates %q: %w", s, err)
+	}
+	c, err := strconv.ParseInt(strings.TrimSpace(b), 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid coordinates %q: %w", s, err)
+	}
+	return r, c, nil
+}
+
+func (g *sparseGrid) get(p point, ru rule) byte {
+	if ch, ok := g.cells[p]; ok {
+		return ch
+	}
+	return ru.empty
+}
+
+// neighbor is rule.neighbor for sparse grids: ok is false if the neighbor is
+// off the map.
+func (g *sparseGrid) neighbor(ru rule, p point, d [2]int) (point, bool) {
+	r, rok := moveAlong(p.r, g.min.r, g.max.r, d[0], ru.wrap)
+	c, cok := moveAlong(p.c, g.min.c, g.max.c, d[1], ru.wrap)
+	return point{r, c}, rok && cok
+}
+
+// moveAlong moves v by d on an axis that runs from lo to hi, and reports
+// whether it's still on the axis. The arithmetic is done on offsets from lo in
+// uint64, since the axis can be as long as all of int64 and the span doesn't
+// fit in an int64. If the span is all 2^64 values it wraps to 0, and then
+// wrapping is just the natural overflow of uint64.
+func moveAlong(v, lo, hi int64, d int, wrap bool) (int64, bool) {
+	off := uint64(v) - uint64(lo)
+	last := uint64(hi) - uint64(lo)
+	step := uint64(d)
+	if d < 0 {
+		step = uint64(-d)
+	}
+	var moved uint64
+	switch size := last + 1; {
+	case wrap && size == 0:
+		moved = off + uint64(d)
+	case wrap:
+		step %= size
+		if d >= 0 && step < size-off {
+			moved = off + step
+		} else if d >= 0 {
+			moved = off - (size - step)
+		} else if step <= off {
+			moved = off - step
+		} else {
+			moved = off + (size - step)
+		}
+	case d >= 0:
+		if step > last-off {
+			return 0, false
+		}
+		moved = off + step
+	default:
+		if step > off {
+			return 0, false
+		}
+		moved = off - step
+	}
+	return int64(uint64(lo) + moved), true
+}
+
+func (g *sparseGrid) countNeighbors(ru rule, p point) int {
+	count := 0
+	for _, d := range ru.stencil {
+		if n, ok := g.neighbor(ru, p, d); ok && ru.counted[g.get(n, ru)] {
+			count++
+		}
+	}
+	return count
+}
+
+func (g *sparseGrid) countRolls(ru rule) int {
+	count := 0
+	for _, ch := range g.cells {
+		if ru.removable[ch] {
+			count++
+		}
+	}
+	return count
+}
+
+// findRemoveables is like the dense version, but only looks at the cells we
+// have, since empty cells are never removable.
+func (g *sparseGrid) findRemoveables(ru rule) []point {
+	var removeables []point
+	for p, ch := range g.cells {
+		if ru.removable[ch] && g.countNeighbors(ru, p) < ru.threshold {
+			removeables = append(removeables, p)
+		}
+	}
+	slices.SortFunc(removeables, comparePoints)
+	return removeables
+}
+
+// peel is removeByWorklist for sparse grids, with maps in place of the count
+// and queued arrays. It needs a monotone rule.
+func (g *sparseGrid) peel(ru rule) ([][]point, error) {
+	if !ru.monotone() {
+		return nil, errors.New("sparse maps need a rule that doesn't count empty cells")
+	}
+	counts := make(map[point]int)
+	queued := make(map[point]bool)
+	var current []point
+	for p, ch := range g.cells {
+		if !ru.removable[ch] {
+			continue
+		}
+		counts[p] = g.countNeighbors(ru, p)
+		if counts[p] < ru.threshold {
+			queued[p] = true
+			current = append(current, p)
+		}
+	}
+
+	var removed [][]point
+	for len(current) > 0 {
+		var dropped []point
+		for _, p := range current {
+			if ru.counted[g.cells[p]] {
+				dropped = append(dropped, p)
+			}
+			delete(g.cells, p)
+		}
+		slices.SortFunc(current, comparePoints)
+		removed = append(removed, current)
+		var next []point
+		for _, p := range dropped {
+			for _, d := range ru.stencil {
+				n, ok := g.neighbor(ru, p, [2]int{-d[0], -d[1]})
+				if !ok || !ru.removable[g.get(n, ru)] {
+					continue
+				}
+				counts[n]--
+				if counts[n] < ru.threshold && !queued[n] {
+					queued[n] = true
+					next = append(next, n)
+				}
+			}
+		}
+		current = next
+	}
+	return removed, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"slices"
+	"sort"
+)
+
+// rangeIndex answers membership queries with a binary search over the merged
+// ranges, rather than checking every range for every value. It also keeps the
+// original ranges around so it can say which ones contained a value.
+type rangeIndex struct {
+	merged  []idRange
+	sources []idRange
+	// order holds the indexes of sources, sorted by start value
+	order []int
+}
+
+// membership is the answer to a query for one value: whether it's fresh, and
+// the indexes (in input order) of every original range that contains it.
+type membership struct {
+	value   int
+	fresh   bool
+	sources []int
+}
+
+func newRangeIndex(ranges []idRange) *rangeIndex {
+	ix := &rangeIndex{
+		merged:  mergeRanges(ranges, true),
+		sources: slices.Clone(ranges),
+		order:   make([]int, len(ranges)),
+	}
+	for i := range ix.order {
+		ix.order[i] = i
+	}
+	sort.SliceStable(ix.order, func(i, j int) bool {
+		return ix.sources[ix.order[i]].start < ix.sources[ix.order[j]].start
+	})
+	return ix
+}
+
+func (ix *rangeIndex) contains(value int) bool {
+	// find the first merged range that ends at or after value; since they
+	// don't overlap, it's the only one that could contain it
+	i := sort.Search(len(ix.merged), func(i int) bool {
+		return ix.merged[i].end >= value
+	})
+	return i < len(ix.merged) && ix.merged[i].contains(value)
+}
+
+// query answers a batch of values at once, reporting the original ranges that
+// contain each one. It sweeps through the values in sorted order, keeping the
+// set of ranges that have started and not yet ended, so the cost is a sort
+// plus the size of the answer. Results are in the same order as values.
+func (ix *rangeIndex) query(values []int) []membership {
+	results := make([]membership, len(values))
+	byValue := make([]int, len(values))
+	for i := range byValue {
+		byValue[i] = i
+	}
+	sort.Slice(byValue, func(i, j int) bool {
+		return values[byValue[i]] < values[byValue[j]]
+	})
+
+	var active []int
+	next := 0
+	for _, vi := range byValue {
+		value := values[vi]
+		for next < len(ix.order) && ix.sources[ix.order[next]].start <= value {
+			active = append(active, ix.order[next])
+			next++
+		}
+		active = slices.DeleteFunc(active, func(si int) bool {
+			return ix.sources[si].end < value
+		})
+		results[vi] = membership{value: value, fresh: len(active) > 0}
+		if len(active) > 0 {
+			results[vi].sources = slices.Sorted(slices.Values(active))
+		}
+	}
+	return results
+}
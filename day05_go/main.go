@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"os"
 	"sort"
 	"strconv"
@@ -28,8 +29,21 @@ func (r idRange) overlaps(other idRange) bool {
 		other.contains(r.start) || other.contains(r.end)
 }
 
-func merge(a, b idRange) (idRange, bool) {
-	if a.overlaps(b) {
+// touches reports whether the ranges are next to each other with no gap, like
+// 3-5 and 6-8.
+func (r idRange) touches(other idRange) bool {
+	return (r.end < math.MaxInt && r.end+1 == other.start) ||
+		(other.end < math.MaxInt && other.end+1 == r.start)
+}
+
+func (r idRange) reversed() bool {
+	return r.end < r.start
+}
+
+// merge combines two ranges if they overlap, or if they touch and adjacent is
+// set.
+func merge(a, b idRange, adjacent bool) (idRange, bool) {
+	if a.overlaps(b) || (adjacent && a.touches(b)) {
 		if b.start < a.start {
 			a.start = b.start
 		}
@@ -42,43 +56,51 @@ func merge(a, b idRange) (idRange, bool) {
 }
 
 func part1(ranges []idRange, values []int) int {
+	index := newRangeIndex(ranges)
 	freshcount := 0
-
 	for _, val := range values {
-		for _, r := range ranges {
-			if r.contains(val) {
-				freshcount++
-				break
-			}
+		if index.contains(val) {
+			freshcount++
 		}
 	}
 	return freshcount
 }
 
-// need to consolidate ranges, then measure the total size of
-// all ranges
-func part2(ranges []idRange, values []int) int {
+// mergeRanges returns a sorted list of the ranges with the overlapping ones
+// merged (and the touching ones too, if adjacent is set). It doesn't change
+// the slice it's given. Reversed ranges (where end < start) don't contain
+// any IDs, so they're dropped.
+func mergeRanges(ranges []idRange, adjacent bool) []idRange {
+	sorted := make([]idRange, 0, len(ranges))
+	for _, r := range ranges {
+		if !r.reversed() {
+			sorted = append(sorted, r)
+		}
+	}
 	// sort ranges by start value
-	sort.Slice(ranges, func(i, j int) bool {
-		return ranges[i].start < ranges[j].start
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].start < sorted[j].start
 	})
 
-	// now merge overlapping ranges in place by comparing sequentially
-	last := len(ranges) - 1
-	for i := 0; i < last; {
-		merged, ok := merge(ranges[i], ranges[i+1])
-		if ok {
-			// replace ranges[i] with merged, and remove ranges[i+1]
-			ranges[i] = merged
-			ranges = append(ranges[:i+1], ranges[i+2:]...)
-			last--
-		} else {
-			i++
+	// now merge each range into the last one if we can, comparing sequentially
+	var merged []idRange
+	for _, r := range sorted {
+		if last := len(merged) - 1; last >= 0 {
+			if m, ok := merge(merged[last], r, adjacent); ok {
+				merged[last] = m
+				continue
+			}
 		}
+		merged = append(merged, r)
 	}
+	return merged
+}
 
+// need to consolidate ranges, then measure the total size of
+// all ranges
+func part2(ranges []idRange, values []int) int {
 	total := 0
-	for _, r := range ranges {
+	for _, r := range mergeRanges(ranges, true) {
 		total += size(r)
 	}
 	return total
@@ -95,20 +117,30 @@ func readlines(filename string) ([]idRange, []int) {
 	}
 	ranges := make([]idRange, 0)
 	values := make([]int, 0)
-	for _, line := range strings.Split(string(b), "\n") {
+	for n, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
 		if strings.Contains(line, "-") {
 			// parse range
 			vals := strings.Split(line, "-")
 			if len(vals) != 2 {
-				log.Fatalf("Invalid range: %s", line)
+				log.Fatalf("line %d: invalid range: %s", n+1, line)
+			}
+			lo, err1 := strconv.Atoi(vals[0])
+			hi, err2 := strconv.Atoi(vals[1])
+			if err1 != nil || err2 != nil {
+				log.Fatalf("line %d: invalid range: %s", n+1, line)
 			}
-			lo, _ := strconv.Atoi(vals[0])
-			hi, _ := strconv.Atoi(vals[1])
 			r := idRange{start: lo, end: hi}
+			if r.reversed() {
+				log.Fatalf("line %d: range is reversed: %s", n+1, line)
+			}
 			ranges = append(ranges, r)
 		} else if line != "" {
 			// parse single value
-			val, _ := strconv.Atoi(line)
+			val, err := strconv.Atoi(line)
+			if err != nil {
+				log.Fatalf("line %d: invalid ID: %s", n+1, line)
+			}
 			values = append(values, val)
 		}
 	}
@@ -118,19 +150,98 @@ func readlines(filename string) ([]idRange, []int) {
 func main() {
 	args := os.Args[1:]
 	filename := "sample"
-	if len(args) > 0 {
-		switch args[0] {
+	which := false
+	expr := ""
+	showMerged, adjacent := false, false
+	streaming := false
+	report := false
+	var window *idRange
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch arg {
 		case "sample", "input":
-			filename = args[0]
+			filename = arg
 		case "-s":
 			filename = "sample"
 		case "-i":
 			filename = "input"
+		case "--which":
+			which = true
+		case "--report":
+			report = true
+		case "--window":
+			i++
+			if i >= len(args) {
+				log.Fatal("--window requires a range")
+			}
+			lo, hi, ok := strings.Cut(args[i], "-")
+			start, err1 := strconv.Atoi(lo)
+			end, err2 := strconv.Atoi(hi)
+			if !ok || err1 != nil || err2 != nil || end < start {
+				log.Fatalf("Invalid window: %s", args[i])
+			}
+			window = &idRange{start: start, end: end}
+		case "--stream":
+			streaming = true
+		case "--merged":
+			showMerged = true
+		case "--adjacent":
+			adjacent = true
+		case "--expr":
+			i++
+			if i >= len(args) {
+				log.Fatal("--expr requires an expression")
+			}
+			expr = args[i]
 		default:
-			log.Fatalf("Unknown filename: %s", args[0])
+			if strings.HasPrefix(arg, "-") {
+				log.Fatalf("Unknown option: %s", arg)
+			}
+			filename = arg
+		}
+	}
+	if streaming {
+		if err := stream(os.Stdin, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if expr != "" {
+		inv := readInventory(filename)
+		result, err := inv.evaluate(expr)
+		if err != nil {
+			log.Fatalf("%s: %v", expr, err)
 		}
+		fmt.Println(result)
+		fmt.Println(part1(result, inv.ids))
+		fmt.Println(result.size())
+		return
 	}
+
 	ranges, values := readlines(filename)
+	if report {
+		writeReport(os.Stdout, ranges)
+	}
+	if window != nil {
+		covered := coverage(ranges, *window)
+		fmt.Printf("coverage of %d-%d: %d of %d (%.2f%%)\n", window.start, window.end,
+			covered, size(*window), 100*float64(covered)/float64(size(*window)))
+	}
+	if showMerged {
+		for _, r := range mergeRanges(ranges, adjacent) {
+			fmt.Printf("%d-%d\n", r.start, r.end)
+		}
+	}
+	if which {
+		for _, m := range newRangeIndex(ranges).query(values) {
+			fmt.Printf("%d fresh=%v", m.value, m.fresh)
+			for _, si := range m.sources {
+				fmt.Printf(" %d-%d", ranges[si].start, ranges[si].end)
+			}
+			fmt.Println()
+		}
+	}
 	fmt.Println(part1(ranges, values))
 	fmt.Println(part2(ranges, values))
 }
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"maps"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// randomRanges makes n ranges with starts below limit and sizes up to maxSize.
+func randomRanges(rng *rand.Rand, n, limit, maxSize int) []idRange {
+	ranges := make([]idRange, n)
+	for i := range ranges {
+		start := rng.IntN(limit)
+		ranges[i] = idRange{start: start, end: start + rng.IntN(maxSize)}
+	}
+	return ranges
+}
+
+func Test_rangeIndex(t *testing.T) {
+	rng := rand.New(rand.NewPCG(5, 5))
+	for trial := 0; trial < 50; trial++ {
+		ranges := randomRanges(rng, 1+rng.IntN(20), 200, 30)
+		original := slices.Clone(ranges)
+		values := make([]int, 300)
+		for i := range values {
+			values[i] = rng.IntN(250) - 10
+		}
+		ix := newRangeIndex(ranges)
+		if !slices.Equal(ranges, original) {
+			t.Fatalf("newRangeIndex() changed its input")
+		}
+		results := ix.query(values)
+		for i, val := range values {
+			var want []int
+			for si, r := range ranges {
+				if r.contains(val) {
+					want = append(want, si)
+				}
+			}
+			got := results[i]
+			if got.value != val || got.fresh != (want != nil) || !slices.Equal(got.sources, want) {
+				t.Fatalf("query(%d) = %+v, want sources %v in %v", val, got, want, ranges)
+			}
+			if ix.contains(val) != got.fresh {
+				t.Fatalf("contains(%d) = %v, want %v", val, ix.contains(val), got.fresh)
+			}
+		}
+	}
+}
+
+func Benchmark_part1(b *testing.B) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	ranges := randomRanges(rng, 200, 1e12, 1e9)
+	values := make([]int, 1_000_000)
+	for i := range values {
+		values[i] = rng.IntN(1e12)
+	}
+	for b.Loop() {
+		part1(ranges, values)
+	}
+}
+
+// members lists every ID in the ranges, the slow way.
+func members(ranges []idRange) map[int]bool {
+	ids := make(map[int]bool)
+	for _, r := range ranges {
+		for v := r.start; v <= r.end; v++ {
+			ids[v] = true
+		}
+	}
+	return ids
+}
+
+func Test_evaluate(t *testing.T) {
+	rng := rand.New(rand.NewPCG(6, 6))
+	tests := []struct {
+		expr string
+		want func(a, b, c bool) bool
+	}{
+		{expr: "a", want: func(a, b, c bool) bool { return a }},
+		{expr: "a | b", want: func(a, b, c bool) bool { return a || b }},
+		{expr: "a & b", want: func(a, b, c bool) bool { return a && b }},
+		{expr: "a - b", want: func(a, b, c bool) bool { return a && !b }},
+		{expr: "(a | b) - c", want: func(a, b, c bool) bool { return (a || b) && !c }},
+		{expr: "a | b & c", want: func(a, b, c bool) bool { return a || (b && c) }},
+		{expr: "a - b - c", want: func(a, b, c bool) bool { return a && !b && !c }},
+		{expr: "a - (b - c)", want: func(a, b, c bool) bool { return a && !(b && !c) }},
+		{expr: "((a)&(b|c))", want: func(a, b, c bool) bool { return a && (b || c) }},
+	}
+	for trial := 0; trial < 30; trial++ {
+		raw := map[string][]idRange{
+			"a": randomRanges(rng, 1+rng.IntN(8), 100, 20),
+			"b": randomRanges(rng, 1+rng.IntN(8), 100, 20),
+			"c": randomRanges(rng, 1+rng.IntN(8), 100, 20),
+		}
+		inv := &inventory{sets: make(map[string]rangeSet)}
+		in := make(map[string]map[int]bool)
+		for name, ranges := range raw {
+			inv.sets[name] = newRangeSet(ranges)
+			in[name] = members(ranges)
+		}
+		for _, tt := range tests {
+			got, err := inv.evaluate(tt.expr)
+			if err != nil {
+				t.Fatalf("evaluate(%q) error = %v", tt.expr, err)
+			}
+			gotIDs := members(got)
+			count := 0
+			for v := 0; v < 130; v++ {
+				want := tt.want(in["a"][v], in["b"][v], in["c"][v])
+				if want {
+					count++
+				}
+				if gotIDs[v] != want {
+					t.Fatalf("evaluate(%q) has %d = %v, want %v (sets %v)", tt.expr, v, gotIDs[v], want, raw)
+				}
+			}
+			if got.size() != count {
+				t.Errorf("evaluate(%q).size() = %d, want %d", tt.expr, got.size(), count)
+			}
+			for i := 1; i < len(got); i++ {
+				if got[i].start <= got[i-1].end {
+					t.Errorf("evaluate(%q) = %v, which overlaps itself", tt.expr, got)
+				}
+			}
+		}
+	}
+}
+
+func Test_evaluateErrors(t *testing.T) {
+	inv, err := parseInventory("[a]\n1-5\n[b]\n3-8\n[ids]\n4\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expr := range []string{"", "a |", "(a", "a)", "a b", "c", "ids", "a + b"} {
+		if _, err := inv.evaluate(expr); err == nil {
+			t.Errorf("evaluate(%q) succeeded, want an error", expr)
+		}
+	}
+	for _, bad := range []string{"1-5\n", "[a]\n1-x\n", "[a]\n1-2\n[a]\n", "[1a]\n", "[ids]\nx\n"} {
+		if _, err := parseInventory(bad); err == nil {
+			t.Errorf("parseInventory(%q) succeeded, want an error", bad)
+		}
+	}
+}
+
+func Test_mergeRanges(t *testing.T) {
+	rng := rand.New(rand.NewPCG(7, 7))
+	for trial := 0; trial < 200; trial++ {
+		ranges := randomRanges(rng, rng.IntN(15), 100, 12)
+		// throw in some reversed ranges, which hold nothing
+		for i := range ranges {
+			if rng.IntN(6) == 0 {
+				ranges[i].start, ranges[i].end = ranges[i].end+1, ranges[i].start
+			}
+		}
+		original := slices.Clone(ranges)
+		want := len(members(ranges))
+		for _, adjacent := range []bool{false, true} {
+			merged := mergeRanges(ranges, adjacent)
+			if !slices.Equal(ranges, original) {
+				t.Fatalf("mergeRanges() changed its input")
+			}
+			total := 0
+			for i, r := range merged {
+				total += size(r)
+				if r.reversed() {
+					t.Errorf("mergeRanges(%v, %v) kept reversed range %v", ranges, adjacent, r)
+				}
+				if i > 0 && (merged[i-1].end >= r.start || (adjacent && merged[i-1].touches(r))) {
+					t.Errorf("mergeRanges(%v, %v) = %v, which didn't merge %v and %v", ranges, adjacent, merged, merged[i-1], r)
+				}
+			}
+			if total != want {
+				t.Errorf("mergeRanges(%v, %v) covers %d IDs, want %d", ranges, adjacent, total, want)
+			}
+		}
+	}
+
+	if got := mergeRanges([]idRange{{3, 5}, {6, 8}}, false); len(got) != 2 {
+		t.Errorf("mergeRanges() without adjacent = %v, want 2 ranges", got)
+	}
+	if got := mergeRanges([]idRange{{3, 5}, {6, 8}}, true); !slices.Equal(got, []idRange{{3, 8}}) {
+		t.Errorf("mergeRanges() with adjacent = %v, want [{3 8}]", got)
+	}
+	if got := mergeRanges([]idRange{{math.MaxInt - 1, math.MaxInt}, {1, 2}}, true); len(got) != 2 {
+		t.Errorf("mergeRanges() at MaxInt = %v, want 2 ranges", got)
+	}
+}
+
+func Test_intervalTree(t *testing.T) {
+	rng := rand.New(rand.NewPCG(8, 8))
+	for trial := 0; trial < 50; trial++ {
+		var tree intervalTree
+		var added []idRange
+		for _, r := range randomRanges(rng, 60, 1000, 40) {
+			tree.add(r)
+			added = append(added, r)
+			want := mergeRanges(added, true)
+			if got := tree.ranges(); !slices.Equal(got, want) {
+				t.Fatalf("after adding %v, ranges() = %v, want %v", added, got, want)
+			}
+			if tree.count != len(want) || tree.total != newRangeSet(added).size() {
+				t.Fatalf("after adding %v, count %d and total %d are wrong", added, tree.count, tree.total)
+			}
+			for range 20 {
+				v := rng.IntN(1100)
+				if got, want := tree.contains(v), newRangeIndex(added).contains(v); got != want {
+					t.Fatalf("contains(%d) = %v, want %v", v, got, want)
+				}
+			}
+		}
+	}
+
+	var tree intervalTree
+	tree.add(idRange{math.MinInt, 0})
+	tree.add(idRange{math.MaxInt - 5, math.MaxInt})
+	tree.add(idRange{1, 10})
+	if got := tree.ranges(); len(got) != 2 || !tree.contains(math.MaxInt) || !tree.contains(math.MinInt) {
+		t.Errorf("ranges() at the limits = %v", got)
+	}
+}
+
+func Test_stream(t *testing.T) {
+	in := "3-5\n4\n10-14\n12\n16-20\n15\n6-9\n12-18\n17\n"
+	want := "3 in 1 ranges\n4 fresh\n8 in 2 ranges\n12 fresh\n13 in 3 ranges\n15 spoiled\n" +
+		"17 in 2 ranges\n18 in 1 ranges\n17 fresh\n"
+	var out strings.Builder
+	if err := stream(strings.NewReader(in), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != want {
+		t.Errorf("stream() wrote %q, want %q", out.String(), want)
+	}
+	if err := stream(strings.NewReader("5-3\n"), &out); err == nil {
+		t.Errorf("stream() accepted a reversed range")
+	}
+}
+
+func Test_reports(t *testing.T) {
+	rng := rand.New(rand.NewPCG(9, 9))
+	for trial := 0; trial < 100; trial++ {
+		ranges := randomRanges(rng, 1+rng.IntN(10), 100, 15)
+		depth := make(map[int]int)
+		lo, hi := math.MaxInt, math.MinInt
+		for _, r := range ranges {
+			lo, hi = min(lo, r.start), max(hi, r.end)
+			for v := r.start; v <= r.end; v++ {
+				depth[v]++
+			}
+		}
+
+		// every ID between the first and last range is either covered or in
+		// exactly one gap
+		inGap := members(gaps(ranges))
+		for v := lo; v <= hi; v++ {
+			if inGap[v] == (depth[v] > 0) {
+				t.Fatalf("gaps(%v) gets %d wrong", ranges, v)
+			}
+		}
+		if largest, ok := largestGap(gaps(ranges)); ok {
+			for _, g := range gaps(ranges) {
+				if size(g) > size(largest) {
+					t.Errorf("largestGap() = %v, but %v is larger", largest, g)
+				}
+			}
+		}
+
+		window := idRange{start: rng.IntN(120) - 10, end: rng.IntN(120) - 10}
+		want := 0
+		for v := window.start; v <= window.end; v++ {
+			if depth[v] > 0 {
+				want++
+			}
+		}
+		if got := coverage(ranges, window); got != want {
+			t.Errorf("coverage(%v, %v) = %d, want %d", ranges, window, got, want)
+		}
+
+		segments := overlapDepth(ranges)
+		got := make(map[int]int)
+		for i, seg := range segments {
+			if i > 0 && segments[i-1].r.end+1 == seg.r.start && segments[i-1].depth == seg.depth {
+				t.Errorf("overlapDepth(%v) didn't combine %v and %v", ranges, segments[i-1], seg)
+			}
+			for v := seg.r.start; v <= seg.r.end; v++ {
+				got[v] = seg.depth
+			}
+		}
+		if !maps.Equal(got, depth) {
+			t.Errorf("overlapDepth(%v) = %v", ranges, segments)
+		}
+	}
+}
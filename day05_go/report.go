@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// gaps returns the IDs between the first and last range that no range
+// covers, as a list of ranges.
+func gaps(ranges []idRange) []idRange {
+	var result []idRange
+	merged := mergeRanges(ranges, true)
+	for i := 1; i < len(merged); i++ {
+		// merged ranges don't touch, so there's always at least one ID between
+		result = append(result, idRange{start: merged[i-1].end + 1, end: merged[i].start - 1})
+	}
+	return result
+}
+
+// largestGap returns the biggest of the gaps, or false if there aren't any.
+// Ties go to the first one.
+func largestGap(gaps []idRange) (idRange, bool) {
+	if len(gaps) == 0 {
+		return idRange{}, false
+	}
+	largest := gaps[0]
+	for _, g := range gaps[1:] {
+		if size(g) > size(largest) {
+			largest = g
+		}
+	}
+	return largest, true
+}
+
+// coverage counts how many IDs in the window are covered by the ranges.
+func coverage(ranges []idRange, window idRange) int {
+	if window.reversed() {
+		return 0
+	}
+	covered := 0
+	for _, r := range mergeRanges(ranges, true) {
+		lo, hi := max(r.start, window.start), min(r.end, window.end)
+		if lo <= hi {
+			covered += hi - lo + 1
+		}
+	}
+	return covered
+}
+
+// depthSegment is a stretch of IDs that are all covered by the same number
+// of source ranges.
+type depthSegment struct {
+	r     idRange
+	depth int
+}
+
+// overlapDepth sweeps across the ranges, adding one at each start and
+// removing one just after each end, and returns the segments with a depth of
+// at least one. Neighboring segments always have different depths.
+func overlapDepth(ranges []idRange) []depthSegment {
+	type event struct {
+		pos   int
+		delta int
+	}
+	var events []event
+	for _, r := range ranges {
+		if r.reversed() {
+			continue
+		}
+		events = append(events, event{r.start, 1})
+		// a range that runs to MaxInt never closes
+		if r.end < math.MaxInt {
+			events = append(events, event{r.end + 1, -1})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].pos < events[j].pos
+	})
+
+	var segments []depthSegment
+	depth := 0
+	for i := 0; i < len(events); {
+		pos := events[i].pos
+		for ; i < len(events) && events[i].pos == pos; i++ {
+			depth += events[i].delta
+		}
+		// the depth holds until the next event, or forever if there isn't one
+		end := math.MaxInt
+		if i < len(events) {
+			end = events[i].pos - 1
+		}
+		if depth == 0 {
+			continue
+		}
+		// one range ending right where another starts doesn't change the depth
+		if last := len(segments) - 1; last >= 0 && segments[last].r.end == pos-1 && segments[last].depth == depth {
+			segments[last].r.end = end
+			continue
+		}
+		segments = append(segments, depthSegment{r: idRange{start: pos, end: end}, depth: depth})
+	}
+	return segments
+}
+
+// writeReport prints the gaps and overlap depths for the ranges.
+func writeReport(w io.Writer, ranges []idRange) {
+	g := gaps(ranges)
+	fmt.Fprintf(w, "%d gaps:\n", len(g))
+	for _, r := range g {
+		fmt.Fprintf(w, "  %d-%d (%d)\n", r.start, r.end, size(r))
+	}
+	if largest, ok := largestGap(g); ok {
+		fmt.Fprintf(w, "largest gap: %d-%d (%d)\n", largest.start, largest.end, size(largest))
+	}
+	fmt.Fprintln(w, "overlap depth:")
+	for _, seg := range overlapDepth(ranges) {
+		fmt.Fprintf(w, "  %d-%d x%d\n", seg.r.start, seg.r.end, seg.depth)
+	}
+}
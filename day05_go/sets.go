@@ -0,0 +1,283 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// rangeSet is a sorted list of ranges that don't overlap or touch, as
+// produced by mergeRanges with adjacent set.
+type rangeSet []idRange
+
+func newRangeSet(ranges []idRange) rangeSet {
+	return rangeSet(mergeRanges(ranges, true))
+}
+
+func (s rangeSet) size() int {
+	total := 0
+	for _, r := range s {
+		total += size(r)
+	}
+	return total
+}
+
+func (s rangeSet) String() string {
+	parts := make([]string, len(s))
+	for i, r := range s {
+		parts[i] = fmt.Sprintf("%d-%d", r.start, r.end)
+	}
+	return strings.Join(parts, " ")
+}
+
+func (s rangeSet) union(other rangeSet) rangeSet {
+	return newRangeSet(slices.Concat(s, other))
+}
+
+// intersect walks both sets together; whichever range ends first can't
+// overlap anything later in the other set, so we move past it.
+func (s rangeSet) intersect(other rangeSet) rangeSet {
+	var result rangeSet
+	for i, j := 0, 0; i < len(s) && j < len(other); {
+		lo := max(s[i].start, other[j].start)
+		hi := min(s[i].end, other[j].end)
+		if lo <= hi {
+			result = append(result, idRange{start: lo, end: hi})
+		}
+		if s[i].end < other[j].end {
+			i++
+		} else {
+			j++
+		}
+	}
+	return result
+}
+
+// subtract removes everything in other from s, trimming or splitting the
+// ranges of s as it goes.
+func (s rangeSet) subtract(other rangeSet) rangeSet {
+	var result rangeSet
+	j := 0
+	for _, r := range s {
+		// skip the ranges that end before this one starts
+		for j < len(other) && other[j].end < r.start {
+			j++
+		}
+		for k := j; k < len(other) && other[k].start <= r.end; k++ {
+			if other[k].start > r.start {
+				result = append(result, idRange{start: r.start, end: other[k].start - 1})
+			}
+			if other[k].end >= r.end {
+				// nothing left of r
+				r = idRange{start: 1, end: 0}
+				break
+			}
+			r.start = other[k].end + 1
+		}
+		if !r.reversed() {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+// inventory is a file of named range sets, plus the IDs to check against
+// them. Each set starts with a "[name]" line followed by its ranges; the IDs
+// go in a set called "[ids]", one per line. Blank lines and lines starting
+// with # are ignored.
+type inventory struct {
+	sets map[string]rangeSet
+	ids  []int
+}
+
+func parseInventory(data string) (*inventory, error) {
+	inv := &inventory{sets: make(map[string]rangeSet)}
+	raw := make(map[string][]idRange)
+	name := ""
+	for n, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			name = strings.TrimSpace(line[1 : len(line)-1])
+			if !isSetName(name) {
+				return nil, fmt.Errorf("line %d: invalid set name %q", n+1, name)
+			}
+			if _, ok := raw[name]; ok {
+				return nil, fmt.Errorf("line %d: set %q defined twice", n+1, name)
+			}
+			raw[name] = []idRange{}
+		case name == "":
+			return nil, fmt.Errorf("line %d: %q is not in a set", n+1, line)
+		case name == "ids":
+			val, err := strconv.Atoi(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid ID %q", n+1, line)
+			}
+			inv.ids = append(inv.ids, val)
+		default:
+			lo, hi, ok := strings.Cut(line, "-")
+			start, err1 := strconv.Atoi(lo)
+			end, err2 := strconv.Atoi(hi)
+			if !ok || err1 != nil || err2 != nil {
+				return nil, fmt.Errorf("line %d: invalid range %q", n+1, line)
+			}
+			if end < start {
+				return nil, fmt.Errorf("line %d: range %q is reversed", n+1, line)
+			}
+			raw[name] = append(raw[name], idRange{start: start, end: end})
+		}
+	}
+	delete(raw, "ids")
+	for name, ranges := range raw {
+		inv.sets[name] = newRangeSet(ranges)
+	}
+	return inv, nil
+}
+
+func readInventory(filename string) *inventory {
+	b, err := os.ReadFile(fmt.Sprintf("./data/%s.txt", filename))
+	if err != nil {
+		log.Fatal(err)
+	}
+	inv, err := parseInventory(string(b))
+	if err != nil {
+		log.Fatalf("%s: %v", filename, err)
+	}
+	return inv
+}
+
+func isSetName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, ch := range s {
+		if ch != '_' && !unicode.IsLetter(ch) && (i == 0 || !unicode.IsDigit(ch)) {
+			return false
+		}
+	}
+	return true
+}
+
+// evaluate computes a set expression over the named sets. The operators are
+// | (union), - (difference) and & (intersection), and & binds tighter than
+// the other two, so "a | b & c - d" means "(a | (b & c)) - d". Parentheses
+// work as usual.
+func (inv *inventory) evaluate(expr string) (rangeSet, error) {
+	p := &exprParser{inv: inv, input: expr}
+	result, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.next(); tok != "" {
+		return nil, fmt.Errorf("unexpected %q at position %d", tok, p.pos-len(tok)+1)
+	}
+	return result, nil
+}
+
+// exprParser is a recursive-descent parser that evaluates as it goes.
+type exprParser struct {
+	inv   *inventory
+	input string
+	pos   int
+	// peeked is a token that has been read but not used yet
+	peeked string
+}
+
+// next returns the next token: an operator, a parenthesis, a set name, or ""
+// at the end of the input.
+func (p *exprParser) next() string {
+	if p.peeked != "" {
+		tok := p.peeked
+		p.peeked = ""
+		return tok
+	}
+	for p.pos < len(p.input) && p.input[p.pos] == ' ' {
+		p.pos++
+	}
+	if p.pos >= len(p.input) {
+		return ""
+	}
+	start := p.pos
+	if strings.IndexByte("|&-()", p.input[p.pos]) >= 0 {
+		p.pos++
+		return p.input[start:p.pos]
+	}
+	for p.pos < len(p.input) && strings.IndexByte("|&-() ", p.input[p.pos]) < 0 {
+		p.pos++
+	}
+	return p.input[start:p.pos]
+}
+
+func (p *exprParser) peek() string {
+	if p.peeked == "" {
+		p.peeked = p.next()
+	}
+	return p.peeked
+}
+
+// expr := term (("|" | "-") term)*
+func (p *exprParser) parseExpr() (rangeSet, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "|" || p.peek() == "-" {
+		op := p.next()
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		if op == "|" {
+			left = left.union(right)
+		} else {
+			left = left.subtract(right)
+		}
+	}
+	return left, nil
+}
+
+// term := factor ("&" factor)*
+func (p *exprParser) parseTerm() (rangeSet, error) {
+	left, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "&" {
+		p.next()
+		right, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		left = left.intersect(right)
+	}
+	return left, nil
+}
+
+// factor := name | "(" expr ")"
+func (p *exprParser) parseFactor() (rangeSet, error) {
+	tok := p.next()
+	switch tok {
+	case "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	case "(":
+		result, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if tok := p.next(); tok != ")" {
+			return nil, fmt.Errorf("missing ) at position %d", p.pos+1)
+		}
+		return result, nil
+	}
+	set, ok := p.inv.sets[tok]
+	if !ok {
+		return nil, fmt.Errorf("unknown set %q", tok)
+	}
+	return set, nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+)
+
+// intervalTree holds merged ranges in a treap keyed on the start value, so
+// ranges can be added one at a time in O(log n) (plus the ranges they absorb)
+// while keeping track of the total size covered.
+type intervalTree struct {
+	root  *treapNode
+	count int
+	total int
+}
+
+type treapNode struct {
+	r           idRange
+	priority    uint64
+	left, right *treapNode
+}
+
+// split divides the tree into the nodes with start <= key and the rest.
+func split(t *treapNode, key int) (*treapNode, *treapNode) {
+	if t == nil {
+		return nil, nil
+	}
+	if t.r.start <= key {
+		r, right := split(t.right, key)
+		t.right = r
+		return t, right
+	}
+	left, l := split(t.left, key)
+	t.left = l
+	return left, t
+}
+
+// join puts two trees back together; every start in a must be less than
+// every start in b.
+func join(a, b *treapNode) *treapNode {
+	switch {
+	case a == nil:
+		return b
+	case b == nil:
+		return a
+	case a.priority > b.priority:
+		a.right = join(a.right, b)
+		return a
+	default:
+		b.left = join(a, b.left)
+		return b
+	}
+}
+
+// popMax removes the node with the largest start and returns it along with
+// what's left of the tree.
+func popMax(t *treapNode) (*treapNode, *treapNode) {
+	if t.right == nil {
+		rest := t.left
+		t.left = nil
+		return t, rest
+	}
+	last, rest := popMax(t.right)
+	t.right = rest
+	return last, t
+}
+
+// add inserts a range, merging it with any ranges it overlaps or touches.
+// Reversed ranges hold nothing and are ignored.
+func (it *intervalTree) add(r idRange) {
+	if r.reversed() {
+		return
+	}
+	// everything that starts before r might reach it; only the last of those
+	// can, since they don't overlap each other
+	var left, right *treapNode
+	if r.start == math.MinInt {
+		right = it.root
+	} else {
+		left, right = split(it.root, r.start-1)
+	}
+	if left != nil {
+		prev, rest := popMax(left)
+		if merged, ok := merge(prev.r, r, true); ok {
+			r = merged
+			it.drop(prev.r)
+			left = rest
+		} else {
+			left = join(rest, prev)
+		}
+	}
+	// everything that starts inside r, or right after it, gets absorbed
+	var absorbed *treapNode
+	if r.end == math.MaxInt {
+		absorbed, right = right, nil
+	} else {
+		absorbed, right = split(right, r.end+1)
+	}
+	it.removeAll(absorbed, &r)
+
+	node := &treapNode{r: r, priority: rand.Uint64()}
+	it.root = join(join(left, node), right)
+	it.count++
+	it.total += size(r)
+}
+
+// drop accounts for a range leaving the tree.
+func (it *intervalTree) drop(r idRange) {
+	it.count--
+	it.total -= size(r)
+}
+
+// removeAll accounts for every range in t going away, stretching r to cover
+// the last of them.
+func (it *intervalTree) removeAll(t *treapNode, r *idRange) {
+	if t == nil {
+		return
+	}
+	it.drop(t.r)
+	r.end = max(r.end, t.r.end)
+	it.removeAll(t.left, r)
+	it.removeAll(t.right, r)
+}
+
+func (it *intervalTree) contains(value int) bool {
+	// find the range with the largest start that's <= value
+	var best *treapNode
+	for t := it.root; t != nil; {
+		if t.r.start <= value {
+			best = t
+			t = t.right
+		} else {
+			t = t.left
+		}
+	}
+	return best != nil && best.r.contains(value)
+}
+
+// ranges returns the merged ranges in order.
+func (it *intervalTree) ranges() []idRange {
+	var result []idRange
+	var walk func(t *treapNode)
+	walk = func(t *treapNode) {
+		if t == nil {
+			return
+		}
+		walk(t.left)
+		result = append(result, t.r)
+		walk(t.right)
+	}
+	walk(it.root)
+	return result
+}
+
+// stream reads ranges and IDs in any order, one per line. After each range it
+// writes the total size of the fresh ranges so far, and after each ID whether
+// it's fresh given the ranges seen up to that point.
+func stream(in io.Reader, out io.Writer) error {
+	var tree intervalTree
+	scanner := bufio.NewScanner(in)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if lo, hi, ok := strings.Cut(line, "-"); ok {
+			start, err1 := strconv.Atoi(lo)
+			end, err2 := strconv.Atoi(hi)
+			if err1 != nil || err2 != nil || end < start {
+				return fmt.Errorf("line %d: invalid range: %s", n, line)
+			}
+			tree.add(idRange{start: start, end: end})
+			fmt.Fprintf(out, "%d in %d ranges\n", tree.total, tree.count)
+			continue
+		}
+		val, err := strconv.Atoi(line)
+		if err != nil {
+			return fmt.Errorf("line %d: invalid ID: %s", n, line)
+		}
+		if tree.contains(val) {
+			fmt.Fprintf(out, "%d fresh\n", val)
+		} else {
+			fmt.Fprintf(out, "%d spoiled\n", val)
+		}
+	}
+	return scanner.Err()
+}
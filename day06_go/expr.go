@@ -0,0 +1,277 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// value is a worksheet number. It stays an int as long as it fits, and is
+// promoted to a big.Int as soon as an operation would overflow.
+type value struct {
+	n   int
+	big *big.Int // nil unless the value doesn't fit in an int
+}
+
+func intValue(n int) value {
+	return value{n: n}
+}
+
+// bigValue makes a value from a big.Int, demoting it to an int if it fits.
+func bigValue(b *big.Int) value {
+	if b.IsInt64() && b.Int64() >= math.MinInt && b.Int64() <= math.MaxInt {
+		return value{n: int(b.Int64())}
+	}
+	return value{big: b}
+}
+
+// parseValue reads a string of decimal digits, however long it is.
+func parseValue(s string) (value, error) {
+	b, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		return value{}, fmt.Errorf("invalid number %q", s)
+	}
+	return bigValue(b), nil
+}
+
+func (v value) isBig() bool {
+	return v.big != nil
+}
+
+func (v value) toBig() *big.Int {
+	if v.big != nil {
+		return v.big
+	}
+	return big.NewInt(int64(v.n))
+}
+
+func (v value) String() string {
+	if v.big != nil {
+		return v.big.String()
+	}
+	return fmt.Sprint(v.n)
+}
+
+// operator is a binary operation. A problem applies it across all of its
+// numbers from left to right, so "-" on 10, 3, 2 is (10 - 3) - 2.
+type operator struct {
+	// small does the operation on ints, and returns false if the result
+	// doesn't fit. It's optional; without it every value is promoted.
+	small func(a, b int) (int, bool, error)
+	// big does the operation on big.Ints.
+	big func(a, b *big.Int) (*big.Int, error)
+}
+
+func (op operator) apply(a, b value) (value, error) {
+	if op.small != nil && !a.isBig() && !b.isBig() {
+		r, ok, err := op.small(a.n, b.n)
+		if err != nil {
+			return value{}, err
+		}
+		if ok {
+			return intValue(r), nil
+		}
+	}
+	r, err := op.big(a.toBig(), b.toBig())
+	if err != nil {
+		return value{}, err
+	}
+	return bigValue(r), nil
+}
+
+var errDivideByZero = errors.New("division by zero")
+
+var operators = map[string]operator{
+	"+": {
+		small: func(a, b int) (int, bool, error) {
+			r := a + b
+			return r, (a >= 0) != (b >= 0) || (r >= 0) == (a >= 0), nil
+		},
+		big: func(a, b *big.Int) (*big.Int, error) { return new(big.Int).Add(a, b), nil },
+	},
+	"-": {
+		small: func(a, b int) (int, bool, error) {
+			r := a - b
+			return r, (a >= 0) == (b >= 0) || (r >= 0) == (a >= 0), nil
+		},
+		big: func(a, b *big.Int) (*big.Int, error) { return new(big.Int).Sub(a, b), nil },
+	},
+	"*": {
+		small: mulInt,
+		big:   func(a, b *big.Int) (*big.Int, error) { return new(big.Int).Mul(a, b), nil },
+	},
+	"/": {
+		small: func(a, b int) (int, bool, error) {
+			if b == 0 {
+				return 0, false, errDivideByZero
+			}
+			return a / b, a != math.MinInt || b != -1, nil
+		},
+		big: func(a, b *big.Int) (*big.Int, error) {
+			if b.Sign() == 0 {
+				return nil, errDivideByZero
+			}
+			return new(big.Int).Quo(a, b), nil
+		},
+	},
+	"%": {
+		small: func(a, b int) (int, bool, error) {
+			if b == 0 {
+				return 0, false, errDivideByZero
+			}
+			return a % b, true, nil
+		},
+		big: func(a, b *big.Int) (*big.Int, error) {
+			if b.Sign() == 0 {
+				return nil, errDivideByZero
+			}
+			return new(big.Int).Rem(a, b), nil
+		},
+	},
+	"^": {
+		small: powInt,
+		big: func(a, b *big.Int) (*big.Int, error) {
+			if b.Sign() < 0 {
+				return nil, fmt.Errorf("negative exponent %s", b)
+			}
+			if !b.IsInt64() {
+				return nil, fmt.Errorf("exponent %s is too large", b)
+			}
+			return new(big.Int).Exp(a, b, nil), nil
+		},
+	},
+	"min": {
+		small: func(a, b int) (int, bool, error) { return min(a, b), true, nil },
+		big: func(a, b *big.Int) (*big.Int, error) {
+			if a.Cmp(b) <= 0 {
+				return a, nil
+			}
+			return b, nil
+		},
+	},
+	"max": {
+		small: func(a, b int) (int, bool, error) { return max(a, b), true, nil },
+		big: func(a, b *big.Int) (*big.Int, error) {
+			if a.Cmp(b) >= 0 {
+				return a, nil
+			}
+			return b, nil
+		},
+	},
+}
+
+// registerOperator adds an operator (or replaces an existing one) so it can
+// be used in worksheets.
+func registerOperator(name string, op operator) {
+	operators[name] = op
+}
+
+func mulInt(a, b int) (int, bool, error) {
+	if a == 0 || b == 0 {
+		return 0, true, nil
+	}
+	r := a * b
+	if r/b != a || (a == -1 && b == math.MinInt) || (b == -1 && a == math.MinInt) {
+		return 0, false, nil
+	}
+	return r, true, nil
+}
+
+func powInt(a, b int) (int, bool, error) {
+	if b < 0 {
+		return 0, false, fmt.Errorf("negative exponent %d", b)
+	}
+	result := 1
+	for ; b > 0; b >>= 1 {
+		var ok bool
+		if b&1 == 1 {
+			if result, ok, _ = mulInt(result, a); !ok {
+				return 0, false, nil
+			}
+		}
+		if b > 1 {
+			if a, ok, _ = mulInt(a, a); !ok {
+				return 0, false, nil
+			}
+		}
+	}
+	return result, true, nil
+}
+
+// node is a worksheet expression: a number, or an operator applied to a list
+// of operands.
+type node interface {
+	eval() (value, error)
+	String() string
+}
+
+type number struct {
+	value
+}
+
+func (n number) eval() (value, error) {
+	return n.value, nil
+}
+
+type application struct {
+	op   string
+	args []node
+}
+
+func (a application) eval() (value, error) {
+	op, ok := operators[a.op]
+	if !ok {
+		return value{}, fmt.Errorf("unknown op: '%s'", a.op)
+	}
+	if len(a.args) == 0 {
+		return value{}, fmt.Errorf("no operands for '%s'", a.op)
+	}
+	result, err := a.args[0].eval()
+	if err != nil {
+		return value{}, err
+	}
+	for _, arg := range a.args[1:] {
+		v, err := arg.eval()
+		if err != nil {
+			return value{}, err
+		}
+		if result, err = op.apply(result, v); err != nil {
+			return value{}, fmt.Errorf("%s: %w", a, err)
+		}
+	}
+	return result, nil
+}
+
+func (a application) String() string {
+	args := make([]string, len(a.args))
+	for i, arg := range a.args {
+		args[i] = arg.String()
+	}
+	return "(" + a.op + " " + strings.Join(args, " ") + ")"
+}
+
+// problem builds the expression for one worksheet problem.
+func problem(op string, values []value) node {
+	args := make([]node, len(values))
+	for i, v := range values {
+		args[i] = number{v}
+	}
+	return application{op: op, args: args}
+}
+
+// solve adds up the answers to all the problems, however big the total gets.
+func solve(problems []node) (value, error) {
+	grandtotal := intValue(0)
+	for _, p := range problems {
+		v, err := p.eval()
+		if err != nil {
+			return value{}, err
+		}
+		if grandtotal, err = operators["+"].apply(grandtotal, v); err != nil {
+			return value{}, err
+		}
+	}
+	return grandtotal, nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// cell is a single digit on the worksheet and where it was.
+type cell struct {
+	row, col int
+	ch       byte
+}
+
+// block is one problem on the worksheet: the columns between two all-blank
+// separator columns, with the numbers above and the operator on the bottom
+// row. Columns are inclusive.
+type block struct {
+	left, right int
+	nrows       int // number rows, not counting the operator row
+	op          string
+	opRow       int
+	opCol       int
+	digits      []cell // in reading order: top to bottom, left to right
+	// text is what the block looks like on the worksheet, one string per
+	// row including the operator row, padded to the block's width
+	text []string
+}
+
+// parseWorksheet splits the worksheet into problem blocks. Lines can be
+// ragged; anything past the end of a line counts as blank. The last non-blank
+// line holds the operators.
+func parseWorksheet(lines []string) ([]block, error) {
+	var rows []string
+	for _, line := range lines {
+		rows = append(rows, strings.TrimRight(line, "\r"))
+	}
+	for len(rows) > 0 && strings.TrimSpace(rows[len(rows)-1]) == "" {
+		rows = rows[:len(rows)-1]
+	}
+	if len(rows) < 2 {
+		return nil, fmt.Errorf("worksheet needs at least one row of numbers and a row of operators")
+	}
+	width := 0
+	for _, row := range rows {
+		width = max(width, len(row))
+	}
+	at := func(r, c int) byte {
+		if c < len(rows[r]) {
+			return rows[r][c]
+		}
+		return ' '
+	}
+	blankColumn := func(c int) bool {
+		for r := range rows {
+			if at(r, c) != ' ' {
+				return false
+			}
+		}
+		return true
+	}
+
+	opRow := len(rows) - 1
+	var blocks []block
+	for c := 0; c < width; c++ {
+		if blankColumn(c) {
+			continue
+		}
+		b := block{left: c, nrows: opRow, opRow: opRow}
+		for c < width && !blankColumn(c) {
+			c++
+		}
+		b.right = c - 1
+		for r := range rows {
+			var sb strings.Builder
+			for col := b.left; col <= b.right; col++ {
+				sb.WriteByte(at(r, col))
+			}
+			b.text = append(b.text, sb.String())
+		}
+
+		for r := 0; r < opRow; r++ {
+			for col := b.left; col <= b.right; col++ {
+				ch := at(r, col)
+				switch {
+				case ch == ' ':
+				case ch >= '0' && ch <= '9':
+					b.digits = append(b.digits, cell{row: r, col: col, ch: ch})
+				default:
+					return nil, fmt.Errorf("row %d col %d: unexpected %q in a number", r+1, col+1, ch)
+				}
+			}
+		}
+		var op strings.Builder
+		for col := b.left; col <= b.right; col++ {
+			op.WriteByte(at(opRow, col))
+		}
+		b.op = strings.TrimSpace(op.String())
+		if b.op == "" {
+			return nil, fmt.Errorf("columns %d-%d: problem has no operator", b.left+1, b.right+1)
+		}
+		if strings.Contains(b.op, " ") {
+			return nil, fmt.Errorf("columns %d-%d: more than one operator in a problem", b.left+1, b.right+1)
+		}
+		b.opCol = b.left + strings.Index(op.String(), b.op)
+		blocks = append(blocks, b)
+	}
+	return blocks, nil
+}
+
+// digitsValue turns digits into a number, in the order given. The parser
+// only lets digits through, so this can't fail.
+func digitsValue(digits []cell) value {
+	s := make([]byte, len(digits))
+	for i, d := range digits {
+		s[i] = d.ch
+	}
+	v, _ := parseValue(string(s))
+	return v
+}
+
+// orientation says how to read the numbers out of a block. By default each
+// row is a number, read left to right, and the rows are taken top to bottom.
+type orientation struct {
+	// each column is a number instead, read top to bottom, and the columns
+	// are taken left to right
+	columns bool
+	// take the numbers in the opposite order: bottom to top, or right to left
+	reverseOrder bool
+	// read each number's digits backwards: right to left, or bottom to top
+	reverseDigits bool
+}
+
+// orientations are the readings that can be chosen by name. Part 1 reads
+// rows and part 2 reads columns.
+var orientations = map[string]orientation{
+	"rows":           {},
+	"rows-up":        {reverseOrder: true},
+	"mirrored":       {reverseDigits: true},
+	"mirrored-up":    {reverseOrder: true, reverseDigits: true},
+	"columns":        {columns: true, reverseOrder: true},
+	"columns-ltr":    {columns: true},
+	"columns-up":     {columns: true, reverseOrder: true, reverseDigits: true},
+	"columns-ltr-up": {columns: true, reverseDigits: true},
+}
+
+// read builds the block's problem in the given orientation. Rows or columns
+// without any digits are skipped.
+func (b block) read(o orientation) node {
+	var groups [][]cell
+	if o.columns {
+		for c := b.left; c <= b.right; c++ {
+			groups = append(groups, b.digitsWhere(func(d cell) bool { return d.col == c }))
+		}
+	} else {
+		for r := 0; r < b.nrows; r++ {
+			groups = append(groups, b.digitsWhere(func(d cell) bool { return d.row == r }))
+		}
+	}
+	if o.reverseOrder {
+		slices.Reverse(groups)
+	}
+	var values []value
+	for _, digits := range groups {
+		if len(digits) == 0 {
+			continue
+		}
+		if o.reverseDigits {
+			slices.Reverse(digits)
+		}
+		values = append(values, digitsValue(digits))
+	}
+	return problem(b.op, values)
+}
+
+// digitsWhere returns the block's digits that match, in reading order.
+func (b block) digitsWhere(match func(cell) bool) []cell {
+	var digits []cell
+	for _, d := range b.digits {
+		if match(d) {
+			digits = append(digits, d)
+		}
+	}
+	return digits
+}
+
+// difference is a problem that comes out differently in two orientations.
+type difference struct {
+	index  int
+	block  block
+	a, b   node
+	va, vb value
+}
+
+// compareOrientations reads every block both ways and returns the problems
+// where the answers don't match.
+func compareOrientations(blocks []block, oa, ob orientation) ([]difference, error) {
+	var diffs []difference
+	for i, blk := range blocks {
+		d := difference{index: i, block: blk, a: blk.read(oa), b: blk.read(ob)}
+		var err error
+		if d.va, err = d.a.eval(); err != nil {
+			return nil, err
+		}
+		if d.vb, err = d.b.eval(); err != nil {
+			return nil, err
+		}
+		if d.va.String() != d.vb.String() {
+			diffs = append(diffs, d)
+		}
+	}
+	return diffs, nil
+}
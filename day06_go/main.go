@@ -4,41 +4,34 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"maps"
 	"os"
-	"regexp"
+	"slices"
 	"strings"
 )
 
-func part1(lines [][]string) int {
-	grandtotal := 0
-	ops := lines[len(lines)-1]
-	lines = lines[:len(lines)-1]
-	for i := range len(ops) {
-		op := ops[i]
-		switch op {
-		case "+":
-			total := 0
-			for _, line := range lines {
-				num := 0
-				fmt.Sscanf(line[i], "%d", &num)
-				total += num
-			}
-			grandtotal += total
-		case "*":
-			product := 1
-			for _, line := range lines {
-				num := 0
-				fmt.Sscanf(line[i], "%d", &num)
-				product *= num
-			}
-			grandtotal += product
-		default:
-			log.Fatalf("Unknown op: %s", op)
-		}
+// solveBlocks reads every block in the given orientation and adds up the
+// answers.
+func solveBlocks(blocks []block, o orientation) value {
+	problems := make([]node, len(blocks))
+	for i, b := range blocks {
+		problems[i] = b.read(o)
+	}
+	grandtotal, err := solve(problems)
+	if err != nil {
+		log.Fatal(err)
 	}
 	return grandtotal
 }
 
+func part1(blocks []block) value {
+	return solveBlocks(blocks, orientations["rows"])
+}
+
+func part2(blocks []block) value {
+	return solveBlocks(blocks, orientations["columns"])
+}
+
 func readlines(filename string) []string {
 	f, err := os.Open(fmt.Sprintf("./data/%s.txt", filename))
 	if err != nil {
@@ -52,101 +45,89 @@ func readlines(filename string) []string {
 	return lines
 }
 
-func splitLinesByBlanks(lines []string) [][]string {
-	data := make([][]string, 0, len(lines))
-	for _, line := range lines {
-		if line == "" {
-			continue
-		}
-		line = strings.TrimSpace(line)
-		row := regexp.MustCompile(`\s+`).Split(line, -1)
-		data = append(data, row)
-	}
-	return data
-}
-
-func rotateLines(lines []string) []string {
-	maxlen := 0
-	for _, line := range lines {
-		if len(line) > maxlen {
-			maxlen = len(line)
-		}
-	}
-	// Pad lines to maxlen with spaces
-	for i, line := range lines {
-		if len(line) < maxlen {
-			lines[i] = line + strings.Repeat(" ", maxlen-len(line))
-		}
-	}
-	rotated := make([]string, 0)
-	for i := maxlen - 1; i >= 0; i-- {
-		s := ""
-		for _, line := range lines {
-			s += string(line[i])
-		}
-		rotated = append(rotated, s)
-	}
-	return rotated
-}
-
-func part2(lines []string) int {
-	linedata := rotateLines(lines)
-	grandtotal := 0
-	values := []int{}
-	pat := regexp.MustCompile(`\s*(\d+)\s*([+*]?)`)
-	for lin := range linedata {
-		matches := pat.FindStringSubmatch(linedata[lin])
-		if matches == nil {
-			continue
-		}
-		op := matches[2]
-		num := 0
-		if op == "" {
-			fmt.Sscanf(matches[1], "%d", &num)
-			values = append(values, num)
-		} else {
-			fmt.Sscanf(matches[1], "%d", &num)
-			values = append(values, num)
-			result := 0
-			// fmt.Println(values, op)
-			for _, v := range values {
-				switch op {
-				case "+":
-					result += v
-				case "*":
-					if result == 0 {
-						result = 1
-					}
-					result *= v
-				default:
-					log.Fatalf("Unknown op: '%s'", op)
-				}
-			}
-			grandtotal += result
-			values = []int{}
-		}
+func lookupOrientation(name string) orientation {
+	o, ok := orientations[name]
+	if !ok {
+		names := slices.Sorted(maps.Keys(orientations))
+		log.Fatalf("Unknown reading %q, want one of %s", name, strings.Join(names, ", "))
 	}
-
-	return grandtotal
+	return o
 }
 
 func main() {
 	args := os.Args[1:]
 	filename := "sample"
-	if len(args) > 0 {
-		switch args[0] {
+	reading := ""
+	var diff []string
+	show := false
+	annotateFile := ""
+	nextArg := func(i int) string {
+		if i >= len(args) {
+			log.Fatalf("%s requires a value", args[i-1])
+		}
+		return args[i]
+	}
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
 		case "sample", "input":
-			filename = args[0]
+			filename = args[i]
 		case "-s":
 			filename = "sample"
 		case "-i":
 			filename = "input"
+		case "--reading":
+			i++
+			reading = nextArg(i)
+		case "--show":
+			show = true
+		case "--annotate":
+			i++
+			annotateFile = nextArg(i)
+		case "--diff":
+			diff = []string{nextArg(i + 1), nextArg(i + 2)}
+			i += 2
 		default:
-			log.Fatalf("Unknown filename: %s", args[0])
+			log.Fatalf("Unknown filename: %s", args[i])
 		}
 	}
 	lines := readlines(filename)
-	linesData := splitLinesByBlanks(lines)
-	fmt.Println(part1(linesData))
-	fmt.Println(part2(lines))
+	blocks, err := parseWorksheet(lines)
+	if err != nil {
+		log.Fatalf("%s: %v", filename, err)
+	}
+	o := orientations["rows"]
+	if reading != "" {
+		o = lookupOrientation(reading)
+	}
+	if show {
+		if err := render(os.Stdout, blocks, o); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if annotateFile != "" {
+		annotated, err := annotate(lines, blocks, o)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := os.WriteFile(annotateFile, []byte(strings.Join(annotated, "\n")), 0o644); err != nil {
+			log.Fatal(err)
+		}
+	}
+	switch {
+	case diff != nil:
+		diffs, err := compareOrientations(blocks, lookupOrientation(diff[0]), lookupOrientation(diff[1]))
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, d := range diffs {
+			fmt.Printf("problem %d (columns %d-%d): %s = %v, %s = %v\n",
+				d.index+1, d.block.left+1, d.block.right+1, d.a, d.va, d.b, d.vb)
+		}
+		fmt.Printf("%d of %d problems differ\n", len(diffs), len(blocks))
+	case reading != "":
+		fmt.Println(solveBlocks(blocks, o))
+	default:
+		fmt.Println(part1(blocks))
+		fmt.Println(part2(blocks))
+	}
 }
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func ints(ns ...int) []value {
+	values := make([]value, len(ns))
+	for i, n := range ns {
+		values[i] = intValue(n)
+	}
+	return values
+}
+
+func Test_eval(t *testing.T) {
+	registerOperator("avg", operator{big: func(a, b *big.Int) (*big.Int, error) {
+		sum := new(big.Int).Add(a, b)
+		return sum.Quo(sum, big.NewInt(2)), nil
+	}})
+	t.Cleanup(func() { delete(operators, "avg") })
+	tests := []struct {
+		name    string // description of this test case
+		op      string
+		values  []int
+		want    string
+		wantErr bool
+	}{
+		{name: "sum", op: "+", values: []int{123, 45, 6}, want: "174"},
+		{name: "product", op: "*", values: []int{123, 45, 6}, want: "33210"},
+		{name: "difference", op: "-", values: []int{10, 3, 2}, want: "5"},
+		{name: "quotient", op: "/", values: []int{100, 5, 3}, want: "6"},
+		{name: "remainder", op: "%", values: []int{100, 7}, want: "2"},
+		{name: "power", op: "^", values: []int{2, 3, 2}, want: "64"},
+		{name: "zero power", op: "^", values: []int{7, 0}, want: "1"},
+		{name: "min", op: "min", values: []int{5, 2, 9}, want: "2"},
+		{name: "max", op: "max", values: []int{5, 2, 9}, want: "9"},
+		{name: "one number", op: "*", values: []int{42}, want: "42"},
+		{name: "registered", op: "avg", values: []int{10, 20}, want: "15"},
+		{name: "sum overflow", op: "+", values: []int{math.MaxInt, 1, -2}, want: "9223372036854775806"},
+		{name: "difference overflow", op: "-", values: []int{math.MinInt, 1}, want: "-9223372036854775809"},
+		{name: "product overflow", op: "*", values: []int{9999999999, 9999999999, 9999999999}, want: "999999999700000000029999999999"},
+		{name: "product back in range", op: "/", values: []int{math.MinInt, -1, 2}, want: "4611686018427387904"},
+		{name: "power overflow", op: "^", values: []int{10, 20}, want: "100000000000000000000"},
+		{name: "big min", op: "min", values: []int{math.MaxInt, math.MaxInt}, want: "9223372036854775807"},
+		{name: "divide by zero", op: "/", values: []int{1, 0}, wantErr: true},
+		{name: "negative exponent", op: "^", values: []int{2, -1}, wantErr: true},
+		{name: "unknown", op: "?", values: []int{1, 2}, wantErr: true},
+		{name: "empty", op: "+", values: nil, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := problem(tt.op, ints(tt.values...)).eval()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("eval() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.String() != tt.want {
+				t.Errorf("eval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if _, err := problem("%", ints(1, 0)).eval(); !errors.Is(err, errDivideByZero) {
+		t.Errorf("eval() error = %v, want %v", err, errDivideByZero)
+	}
+}
+
+func Test_parseWorksheet(t *testing.T) {
+	tests := []struct {
+		name    string // description of this test case
+		lines   []string
+		rows    []string
+		columns []string
+		wantErr bool
+	}{
+		{
+			name:    "sample",
+			lines:   readlines("sample"),
+			rows:    []string{"(* 123 45 6)", "(+ 328 64 98)", "(* 51 387 215)", "(+ 64 23 314)"},
+			columns: []string{"(* 356 24 1)", "(+ 8 248 369)", "(* 175 581 32)", "(+ 4 431 623)"},
+		},
+		{
+			name:    "left aligned",
+			lines:   []string{"12  7", "3   81", "456 9", "+   *"},
+			rows:    []string{"(+ 12 3 456)", "(* 7 81 9)"},
+			columns: []string{"(+ 6 25 134)", "(* 1 789)"},
+		},
+		{
+			name:    "right aligned",
+			lines:   []string{" 12 7", "  3 81", "456 9", "+   *"},
+			rows:    []string{"(+ 12 3 456)", "(* 7 81 9)"},
+			columns: []string{"(+ 236 15 4)", "(* 1 789)"},
+		},
+		{
+			name:    "ragged, with a trailing blank line",
+			lines:   []string{"1", "22  3", "", "-  max", ""},
+			rows:    []string{"(- 1 22)", "(max 3)"},
+			columns: []string{"(- 2 12)", "(max 3)"},
+		},
+		{
+			name:    "long operator",
+			lines:   []string{"10   4", "200  5", "min  ^"},
+			rows:    []string{"(min 10 200)", "(^ 4 5)"},
+			columns: []string{"(min 0 0 12)", "(^ 45)"},
+		},
+		{name: "two operators", lines: []string{"12 3", "+ *"}, wantErr: true},
+		{name: "no operator", lines: []string{"12 3", "   +"}, wantErr: true},
+		{name: "not a number", lines: []string{"1x", "+ "}, wantErr: true},
+		{name: "no numbers", lines: []string{"+"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks, err := parseWorksheet(tt.lines)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseWorksheet() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if len(blocks) != len(tt.rows) {
+				t.Fatalf("parseWorksheet() found %d problems, want %d", len(blocks), len(tt.rows))
+			}
+			for i, b := range blocks {
+				if got := b.read(orientations["rows"]).String(); got != tt.rows[i] {
+					t.Errorf("read(rows) = %v, want %v", got, tt.rows[i])
+				}
+				if got := b.read(orientations["columns"]).String(); got != tt.columns[i] {
+					t.Errorf("read(columns) = %v, want %v", got, tt.columns[i])
+				}
+			}
+		})
+	}
+}
+
+func Test_solve(t *testing.T) {
+	blocks, err := parseWorksheet([]string{
+		"99999999999 99999999999999999999999",
+		"99999999999 2",
+		"99999999999 1",
+		"*           *",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := part1(blocks)
+	// 99999999999^3 + 99999999999999999999999*2
+	want := "1000000000170000000000299999999997"
+	if total.String() != want {
+		t.Errorf("part1() = %v, want %v", total, want)
+	}
+	if total, _ := solve([]node{problem("+", ints(1, 2))}); total.isBig() {
+		t.Errorf("solve() = %v promoted a small total", total)
+	}
+}
+
+func Test_orientations(t *testing.T) {
+	blocks, err := parseWorksheet([]string{
+		"12 7",
+		"34 8",
+		"-  +",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"rows":           "(- 12 34)",
+		"rows-up":        "(- 34 12)",
+		"mirrored":       "(- 21 43)",
+		"mirrored-up":    "(- 43 21)",
+		"columns":        "(- 24 13)",
+		"columns-ltr":    "(- 13 24)",
+		"columns-up":     "(- 42 31)",
+		"columns-ltr-up": "(- 31 42)",
+	}
+	for name, o := range orientations {
+		if got := blocks[0].read(o).String(); got != want[name] {
+			t.Errorf("read(%s) = %v, want %v", name, got, want[name])
+		}
+	}
+
+	// only the subtraction depends on the order of the numbers
+	diffs, err := compareOrientations(blocks, orientations["columns"], orientations["columns-ltr"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 1 || diffs[0].index != 0 || diffs[0].va.String() != "11" || diffs[0].vb.String() != "-11" {
+		t.Errorf("compareOrientations() = %+v", diffs)
+	}
+}
+
+func Test_render(t *testing.T) {
+	lines := []string{"12 7", "34 8", "*  +", ""}
+	blocks, err := parseWorksheet(lines)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	if err := render(&out, blocks, orientations["columns"]); err != nil {
+		t.Fatal(err)
+	}
+	want := "problem 1 (columns 1-2)\n" +
+		"12 |   24\n" +
+		"34 |   13\n" +
+		"*  | * = 312\n" +
+		"problem 2 (columns 4-4)\n" +
+		"7 |   78\n" +
+		"8 |     \n" +
+		"+ | + = 78\n"
+	if out.String() != want {
+		t.Errorf("render() =\n%s\nwant\n%s", out.String(), want)
+	}
+
+	annotated, err := annotate(lines, blocks, orientations["columns"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the first answer is too wide to leave room for the second
+	wantLines := []string{"12 7", "34 8", "*  +", "312", "   78", ""}
+	if !slices.Equal(annotated, wantLines) {
+		t.Errorf("annotate() = %q, want %q", annotated, wantLines)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// numbers returns the operands of a problem as strings.
+func numbers(n node) []string {
+	app, ok := n.(application)
+	if !ok {
+		return []string{n.String()}
+	}
+	var nums []string
+	for _, arg := range app.args {
+		nums = append(nums, arg.String())
+	}
+	return nums
+}
+
+// render prints each problem as it was read: the block from the worksheet on
+// the left, and the numbers it turned into on the right, with the operator
+// and the answer underneath.
+//
+//	problem 1 (columns 1-3)
+//	123 |   356
+//	 45 |    24
+//	  6 |     1
+//	*   | * = 8544
+func render(w io.Writer, blocks []block, o orientation) error {
+	for i, b := range blocks {
+		p := b.read(o)
+		answer, err := p.eval()
+		if err != nil {
+			return fmt.Errorf("problem %d: %w", i+1, err)
+		}
+		nums := numbers(p)
+		width := 0
+		for _, n := range nums {
+			width = max(width, len(n))
+		}
+		// the block's number rows and the extracted numbers side by side,
+		// however many of each there are
+		blank := strings.Repeat(" ", len(b.text[0]))
+		fmt.Fprintf(w, "problem %d (columns %d-%d)\n", i+1, b.left+1, b.right+1)
+		for r := 0; r < max(b.nrows, len(nums)); r++ {
+			left, right := blank, ""
+			if r < b.nrows {
+				left = b.text[r]
+			}
+			if r < len(nums) {
+				right = nums[r]
+			}
+			fmt.Fprintf(w, "%s | %*s\n", left, width+2, right)
+		}
+		fmt.Fprintf(w, "%s | %s = %v\n", b.text[b.opRow], b.op, answer)
+	}
+	return nil
+}
+
+// annotate returns a copy of the worksheet with each problem's answer
+// written under its operator. Answers that are too wide to fit next to each
+// other go on extra lines.
+func annotate(lines []string, blocks []block, o orientation) ([]string, error) {
+	out := make([]string, 0, len(lines)+1)
+	last := 0
+	for i, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			last = i
+		}
+	}
+	out = append(out, lines[:last+1]...)
+
+	var answers [][]byte
+	for i, b := range blocks {
+		v, err := b.read(o).eval()
+		if err != nil {
+			return nil, fmt.Errorf("problem %d: %w", i+1, err)
+		}
+		text := v.String()
+		// use the first line where this answer doesn't run into the one
+		// before it
+		row := 0
+		for ; row < len(answers); row++ {
+			if len(strings.TrimRight(string(answers[row]), " ")) < b.opCol {
+				break
+			}
+		}
+		if row == len(answers) {
+			answers = append(answers, nil)
+		}
+		for len(answers[row]) < b.opCol {
+			answers[row] = append(answers[row], ' ')
+		}
+		answers[row] = append(answers[row], text...)
+	}
+	for _, a := range answers {
+		out = append(out, string(a))
+	}
+	return append(out, lines[last+1:]...), nil
+}
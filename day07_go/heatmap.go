@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io"
+	"math/big"
+	"strings"
+)
+
+// heatmap records how the beams from every source use the manifold: which
+// splitters they hit, and how many timelines pass through each cell.
+type heatmap struct {
+	lines [][]byte
+	// hit holds the splitters that split a beam, and missed holds the rest,
+	// including any ^ that beams only passed through sideways
+	hit, missed [][2]int
+	// through counts the timelines that pass through each cell. A timeline
+	// that crosses its own path is counted once for each time it passes.
+	through [][]*big.Int
+	hottest *big.Int
+}
+
+// newHeatmap runs every source through the manifold. A timeline passes
+// through a state as many times as there are ways to get there from a source
+// times the ways to go on from there, and a cell is the sum of its states.
+func newHeatmap(lines [][]byte) (*heatmap, error) {
+	g := newBeamGraph(lines, sources(lines))
+	reach, err := g.reach()
+	if err != nil {
+		return nil, err
+	}
+	ways, err := g.ways()
+	if err != nil {
+		return nil, err
+	}
+	h := &heatmap{
+		lines:   lines,
+		through: make([][]*big.Int, len(lines)),
+		hottest: new(big.Int),
+	}
+	for r, line := range lines {
+		h.through[r] = make([]*big.Int, len(line))
+		for c, ch := range line {
+			h.through[r][c] = new(big.Int)
+			if ch != '^' && ch != '+' {
+				continue
+			}
+			if g.split[[2]int{r, c}] {
+				h.hit = append(h.hit, [2]int{r, c})
+			} else {
+				h.missed = append(h.missed, [2]int{r, c})
+			}
+		}
+	}
+	for b, n := range reach {
+		cell := h.through[b.row][b.col]
+		cell.Add(cell, new(big.Int).Mul(n, ways[b]))
+		if cell.Cmp(h.hottest) > 0 {
+			h.hottest.Set(cell)
+		}
+	}
+	return h, nil
+}
+
+// level puts the number of timelines through a cell on a log scale from 1 to
+// 9, where 9 is the hottest cell. Cells that no timeline passes through are 0.
+func (h *heatmap) level(r, c int) int {
+	n := h.through[r][c]
+	if n.Sign() == 0 {
+		return 0
+	}
+	top := h.hottest.BitLen()
+	return (9*n.BitLen() + top - 1) / top
+}
+
+// grid renders the heat level of each cell. Cells that no timeline passes
+// through keep their original character, so the shape of the manifold shows
+// through.
+func (h *heatmap) grid() string {
+	var sb strings.Builder
+	for r, line := range h.lines {
+		for c, ch := range line {
+			if level := h.level(r, c); level > 0 {
+				sb.WriteByte(byte('0' + level))
+			} else {
+				sb.WriteByte(ch)
+			}
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// writeSplitters lists the splitters that were hit and the ones that
+// weren't.
+func (h *heatmap) writeSplitters(w io.Writer) {
+	list := func(name string, cells [][2]int) {
+		fmt.Fprintf(w, "%s %d splitters:", name, len(cells))
+		for _, rc := range cells {
+			fmt.Fprintf(w, " %d,%d", rc[0], rc[1])
+		}
+		fmt.Fprintln(w)
+	}
+	list("hit", h.hit)
+	list("missed", h.missed)
+}
+
+// heatPalette runs from white for empty space, through the components no
+// timeline passes through, to the nine heat levels from pale yellow to dark
+// red.
+var heatPalette = color.Palette{
+	color.White,
+	color.RGBA{0xa0, 0xa0, 0xc0, 0xff}, // components nothing passes through
+	color.RGBA{0x30, 0x60, 0xe0, 0xff}, // splitters that were missed
+	color.RGBA{0xff, 0xf0, 0xa0, 0xff},
+	color.RGBA{0xff, 0xe0, 0x70, 0xff},
+	color.RGBA{0xff, 0xc8, 0x40, 0xff},
+	color.RGBA{0xff, 0xa8, 0x20, 0xff},
+	color.RGBA{0xf8, 0x80, 0x10, 0xff},
+	color.RGBA{0xe8, 0x58, 0x10, 0xff},
+	color.RGBA{0xd0, 0x30, 0x10, 0xff},
+	color.RGBA{0xa8, 0x10, 0x10, 0xff},
+	color.RGBA{0x70, 0x00, 0x00, 0xff},
+}
+
+// image draws the heatmap with each cell as a scale x scale square.
+func (h *heatmap) image(scale int) *image.Paletted {
+	width := 0
+	for _, line := range h.lines {
+		width = max(width, len(line))
+	}
+	img := image.NewPaletted(image.Rect(0, 0, width*scale, len(h.lines)*scale), heatPalette)
+	for r, line := range h.lines {
+		for c, ch := range line {
+			var idx uint8
+			switch level := h.level(r, c); {
+			case level > 0:
+				idx = uint8(2 + level)
+			case ch == '^' || ch == '+':
+				idx = 2
+			case ch != '.':
+				idx = 1
+			}
+			for y := r * scale; y < (r+1)*scale; y++ {
+				for x := c * scale; x < (c+1)*scale; x++ {
+					img.SetColorIndex(x, y, idx)
+				}
+			}
+		}
+	}
+	return img
+}
+
+// writeImage writes the heatmap as a PNG, or as a GIF if format is "gif".
+func (h *heatmap) writeImage(w io.Writer, format string, scale int) error {
+	img := h.image(scale)
+	if format == "gif" {
+		return gif.Encode(w, img, nil)
+	}
+	return png.Encode(w, img)
+}
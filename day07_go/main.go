@@ -5,66 +5,182 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math"
+	"math/big"
+	"math/rand/v2"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 )
 
-func part1(lines [][]byte) int {
-	splitCount := 0
-	startPos := bytes.Index(lines[0], []byte("S"))
-	beams := make([]map[int]struct{}, len(lines))
-	beams[0] = map[int]struct{}{startPos: {}}
-	for i := 1; i < len(lines)-1; i++ {
-		// copy the previous row's beams or split them
-		beams[i] = make(map[int]struct{})
-		for b := range beams[i-1] {
-			if lines[i][b] == '^' {
-				if b > 0 {
-					beams[i][b-1] = struct{}{}
-				}
-				if b < len(lines[i])-1 {
-					beams[i][b+1] = struct{}{}
-				}
-				splitCount++
-			} else {
-				beams[i][b] = struct{}{}
+// step returns the columns a beam in col on the given row moves to on the
+// next row, and whether it was split to get there.
+func step(lines [][]byte, row, col int) ([]int, bool) {
+	if lines[row][col] != '^' {
+		return []int{col}, false
+	}
+	var next []int
+	if col > 0 {
+		next = append(next, col-1)
+	}
+	if col < len(lines[row])-1 {
+		next = append(next, col+1)
+	}
+	return next, true
+}
+
+// beamStats is what we learn by running beams through the manifold.
+type beamStats struct {
+	splits    int
+	timelines *big.Int
+	// merges counts the times a beam arrived in a cell of the grid that
+	// another beam moving the same way had already reached, including a
+	// source that a beam passes through. Beams leaving the grid don't merge.
+	merges int
+	// exits holds the number of timelines that leave through each column of
+	// the bottom row
+	exits []*big.Int
+}
+
+// sources finds every S in the manifold, in reading order. Each one starts a
+// beam heading down.
+func sources(lines [][]byte) []beam {
+	var starts []beam
+	for row, line := range lines {
+		for col, c := range line {
+			if c == 'S' {
+				starts = append(starts, beam{row: row, col: col, dir: south})
 			}
 		}
 	}
-	return splitCount
+	return starts
 }
 
-// memoize the recursive calls
-var memo map[[2]int]int
-
-func doBeam(lines [][]byte, row, col int) int {
-	if val, ok := memo[[2]int{row, col}]; ok {
-		return val
+// simulate counts the splits and timelines for beams starting at starts. If
+// every beam moves down, it runs the manifold top to bottom one row at a
+// time, keeping only the number of timelines that reach each column of the
+// current row. A splitter counts as split if any timeline reaches it, and the
+// number of timelines is the total that make it to the bottom row, where the
+// beams are collected whatever is there. This uses ints if it can, and starts
+// over with big.Ints if the counts get too large. Anything else needs the
+// whole beam graph.
+func simulate(lines [][]byte, starts []beam) (beamStats, error) {
+	if !downward(lines) {
+		return simulateGraph(lines, starts)
+	}
+	if stats, ok := simulateInt(lines, starts); ok {
+		return stats, nil
 	}
-	// fmt.Printf("At row %d col %d char %c\n", row, col, lines[row][col])
-	if row >= len(lines)-1 {
-		return 1 // each time we reach the bottom, count 1 path
+	return simulateBig(lines, starts), nil
+}
+
+// startsByRow groups the start columns by row, so that the row-at-a-time
+// simulations can add them in as they get to them.
+func startsByRow(starts []beam) map[int][]int {
+	byRow := make(map[int][]int)
+	for _, b := range starts {
+		byRow[b.row] = append(byRow[b.row], b.col)
 	}
-	pathCount := 0
-	if lines[row][col] == '^' {
-		if col > 0 {
-			pathCount += doBeam(lines, row+1, col-1)
+	return byRow
+}
+
+func simulateInt(lines [][]byte, starts []beam) (beamStats, bool) {
+	width := len(lines[0])
+	byRow := startsByRow(starts)
+	counts := make([]int, width)
+	splits, merges := 0, 0
+	for row := range lines {
+		for _, col := range byRow[row] {
+			if counts[col] > 0 {
+				merges++
+			}
+			if counts[col] == math.MaxInt {
+				return beamStats{}, false
+			}
+			counts[col]++
 		}
-		if col < len(lines[row])-1 {
-			pathCount += doBeam(lines, row+1, col+1)
+		if row == len(lines)-1 {
+			break
 		}
-	} else {
-		pathCount += doBeam(lines, row+1, col)
+		next := make([]int, width)
+		for col, n := range counts {
+			if n == 0 {
+				continue
+			}
+			dests, split := step(lines, row, col)
+			if split {
+				splits++
+			}
+			for _, d := range dests {
+				if next[d] > 0 {
+					merges++
+				}
+				if next[d] > math.MaxInt-n {
+					return beamStats{}, false
+				}
+				next[d] += n
+			}
+		}
+		counts = next
+	}
+	stats := beamStats{splits: splits, merges: merges}
+	total := 0
+	for _, n := range counts {
+		if total > math.MaxInt-n {
+			return beamStats{}, false
+		}
+		total += n
+		stats.exits = append(stats.exits, big.NewInt(int64(n)))
 	}
-	memo[[2]int{row, col}] = pathCount
-	return pathCount
+	stats.timelines = big.NewInt(int64(total))
+	return stats, true
 }
 
-func part2(lines [][]byte) int {
-	memo = make(map[[2]int]int)
-	splitCount := 0
-	startPos := bytes.Index(lines[0], []byte("S"))
-	splitCount += doBeam(lines, 1, startPos)
-	return splitCount
+func simulateBig(lines [][]byte, starts []beam) beamStats {
+	width := len(lines[0])
+	byRow := startsByRow(starts)
+	counts := make([]*big.Int, width)
+	for col := range counts {
+		counts[col] = new(big.Int)
+	}
+	splits, merges := 0, 0
+	for row := range lines {
+		for _, col := range byRow[row] {
+			if counts[col].Sign() > 0 {
+				merges++
+			}
+			counts[col].Add(counts[col], big.NewInt(1))
+		}
+		if row == len(lines)-1 {
+			break
+		}
+		next := make([]*big.Int, width)
+		for col := range next {
+			next[col] = new(big.Int)
+		}
+		for col, n := range counts {
+			if n.Sign() == 0 {
+				continue
+			}
+			dests, split := step(lines, row, col)
+			if split {
+				splits++
+			}
+			for _, d := range dests {
+				if next[d].Sign() > 0 {
+					merges++
+				}
+				next[d].Add(next[d], n)
+			}
+		}
+		counts = next
+	}
+	total := new(big.Int)
+	for _, n := range counts {
+		total.Add(total, n)
+	}
+	return beamStats{splits: splits, timelines: total, merges: merges, exits: counts}
 }
 
 func readlines(filename string) [][]byte {
@@ -76,25 +192,146 @@ func readlines(filename string) [][]byte {
 	if err != nil {
 		log.Fatal(err)
 	}
+	return parseLines(b)
+}
+
+// parseLines splits the manifold into rows. A newline at the end of the file
+// doesn't start another row.
+func parseLines(b []byte) [][]byte {
+	b = bytes.ReplaceAll(b, []byte("\r\n"), []byte("\n"))
+	b = bytes.TrimSuffix(b, []byte("\n"))
 	return bytes.Split(b, []byte("\n"))
 }
 
 func main() {
 	args := os.Args[1:]
 	filename := "sample"
-	if len(args) > 0 {
-		switch args[0] {
+	var kth *big.Int
+	list, random := 0, 0
+	showSources, showHeatmap := false, false
+	heatmapImage := ""
+	var seed uint64
+	intArg := func(i int) int {
+		if i >= len(args) {
+			log.Fatalf("%s requires a value", args[i-1])
+		}
+		n, err := strconv.Atoi(args[i])
+		if err != nil || n < 0 {
+			log.Fatalf("%s needs a non-negative number: %s", args[i-1], args[i])
+		}
+		return n
+	}
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
 		case "sample", "input":
-			filename = args[0]
+			filename = args[i]
 		case "-s":
 			filename = "sample"
 		case "-i":
 			filename = "input"
+		case "--timeline":
+			i++
+			if i >= len(args) {
+				log.Fatalf("%s requires a value", args[i-1])
+			}
+			k, ok := new(big.Int).SetString(args[i], 10)
+			if !ok || k.Sign() < 0 {
+				log.Fatalf("%s needs a non-negative number: %s", args[i-1], args[i])
+			}
+			kth = k
+		case "--list":
+			i++
+			list = intArg(i)
+		case "--random":
+			i++
+			random = intArg(i)
+		case "--sources":
+			showSources = true
+		case "--heatmap":
+			showHeatmap = true
+		case "--heatmap-image":
+			i++
+			if i >= len(args) {
+				log.Fatal("--heatmap-image requires a filename")
+			}
+			heatmapImage = args[i]
+		case "--seed":
+			i++
+			seed = uint64(intArg(i))
 		default:
-			log.Fatalf("Unknown filename: %s", args[0])
+			if strings.HasPrefix(args[i], "-") {
+				log.Fatalf("Unknown option: %s", args[i])
+			}
+			filename = args[i]
 		}
 	}
 	lines := readlines(filename)
-	fmt.Println(part1(lines))
-	fmt.Println(part2(lines))
+	// part 1 and part 2 come out of the same pass; the splits are counted
+	// even if the beams loop, but then there's no number of timelines
+	stats, err := simulate(lines, sources(lines))
+	fmt.Println(stats.splits)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(stats.timelines)
+
+	if showSources {
+		if err := writeSources(os.Stdout, lines); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if showHeatmap || heatmapImage != "" {
+		h, err := newHeatmap(lines)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if showHeatmap {
+			fmt.Print(h.grid())
+			h.writeSplitters(os.Stdout)
+		}
+		if heatmapImage != "" {
+			f, err := os.Create(heatmapImage)
+			if err != nil {
+				log.Fatal(err)
+			}
+			format := strings.TrimPrefix(filepath.Ext(heatmapImage), ".")
+			if err := h.writeImage(f, format, 4); err != nil {
+				log.Fatal(err)
+			}
+			if err := f.Close(); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+	if kth != nil {
+		t, err := kthTimeline(lines, kth)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(t, t.path)
+	}
+	if list > 0 {
+		n := 0
+		for t := range timelines(lines) {
+			if n >= list {
+				break
+			}
+			fmt.Println(t, t.path)
+			n++
+		}
+	}
+	if random > 0 {
+		x, err := newTimelineIndex(lines)
+		if err != nil {
+			log.Fatal(err)
+		}
+		rng := rand.New(rand.NewPCG(seed, 0))
+		for range random {
+			t, err := x.random(rng)
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Println(t, t.path)
+		}
+	}
 }
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"math/big"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// followChoices walks the manifold making the given choices at each splitter
+// and returns the path, or false if the choices don't fit the manifold.
+func followChoices(lines [][]byte, choices []byte) ([][2]int, bool) {
+	col := slices.Index(lines[0], 'S')
+	path := [][2]int{{0, col}}
+	for row := 1; row < len(lines); row++ {
+		path = append(path, [2]int{row, col})
+		if lines[row][col] == '^' {
+			if len(choices) == 0 {
+				return nil, false
+			}
+			if choices[0] == 'L' {
+				col--
+			} else {
+				col++
+			}
+			choices = choices[1:]
+			if col < 0 || col >= len(lines[row]) {
+				return nil, false
+			}
+		}
+	}
+	return path, len(choices) == 0
+}
+
+// timelineCount is the part 2 answer for lines.
+func timelineCount(t *testing.T, lines [][]byte) *big.Int {
+	t.Helper()
+	stats, err := simulate(lines, sources(lines))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stats.timelines
+}
+
+func Test_timelines(t *testing.T) {
+	lines := readlines("sample")
+	var all []string
+	for tl := range timelines(lines) {
+		path, ok := followChoices(lines, tl.choices)
+		if !ok || !slices.Equal(path, tl.path) {
+			t.Errorf("timeline %s has path %v, want %v", tl, tl.path, path)
+		}
+		all = append(all, tl.String())
+	}
+	if want := timelineCount(t, lines); int64(len(all)) != want.Int64() {
+		t.Errorf("timelines() yielded %d, want %s", len(all), want)
+	}
+	if !slices.IsSorted(all) || len(slices.Compact(slices.Clone(all))) != len(all) {
+		t.Errorf("timelines() aren't distinct and in order: %v", all)
+	}
+
+	if _, err := kthTimeline(lines, big.NewInt(int64(len(all)))); err == nil {
+		t.Errorf("kthTimeline(%d) succeeded, want an error", len(all))
+	}
+
+	// every timeline should turn up if we pick enough of them
+	x, err := newTimelineIndex(lines)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]int)
+	rng := rand.New(rand.NewPCG(1, 2))
+	for range 4000 {
+		tl, err := x.random(rng)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[tl.String()]++
+	}
+	for _, s := range all {
+		if seen[s] < 50 {
+			t.Errorf("random() picked %s %d times out of 4000", s, seen[s])
+		}
+	}
+}
+
+// pyramid builds a manifold where every beam hits a splitter on every other
+// row, so the number of timelines doubles each time.
+func pyramid(splits int) [][]byte {
+	width := 2*splits + 3
+	lines := [][]byte{bytes.Repeat([]byte("."), width)}
+	lines[0][width/2] = 'S'
+	for i := range splits {
+		row := bytes.Repeat([]byte("."), width)
+		for col := width/2 - i; col <= width/2+i; col += 2 {
+			row[col] = '^'
+		}
+		lines = append(lines, row, bytes.Repeat([]byte("."), width))
+	}
+	return lines
+}
+
+func Test_simulate(t *testing.T) {
+	for _, splits := range []int{1, 10, 62, 63, 64, 100} {
+		lines := pyramid(splits)
+		want := new(big.Int).Lsh(big.NewInt(1), uint(splits))
+		stats, err := simulate(lines, sources(lines))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.timelines.Cmp(want) != 0 {
+			t.Errorf("pyramid(%d) has %s timelines, want %s", splits, stats.timelines, want)
+		}
+		if wantSplits := splits * (splits + 1) / 2; stats.splits != wantSplits {
+			t.Errorf("pyramid(%d) has %d splits, want %d", splits, stats.splits, wantSplits)
+		}
+		if _, ok := simulateInt(lines, sources(lines)); ok != (splits < 63) {
+			t.Errorf("simulateInt(pyramid(%d)) ok = %v", splits, ok)
+		}
+		if got := simulateBig(lines, sources(lines)); got.splits != stats.splits || got.timelines.Cmp(want) != 0 {
+			t.Errorf("simulateBig(pyramid(%d)) = %d, %s", splits, got.splits, got.timelines)
+		}
+		if got, err := simulateGraph(lines, sources(lines)); err != nil || got.splits != stats.splits || got.timelines.Cmp(want) != 0 {
+			t.Errorf("simulateGraph(pyramid(%d)) = %d, %s, %v", splits, got.splits, got.timelines, err)
+		}
+	}
+}
+
+func grid(rows ...string) [][]byte {
+	lines := make([][]byte, len(rows))
+	for i, r := range rows {
+		lines[i] = []byte(r)
+	}
+	return lines
+}
+
+func Test_simulateGraph(t *testing.T) {
+	tests := []struct {
+		name      string
+		lines     [][]byte
+		splits    int
+		timelines int64
+		loop      bool
+	}{
+		{"sample", readlines("sample"), 21, 40, false},
+		{"absorber", grid(
+			"..S..",
+			"..^..",
+			".#...",
+			".....",
+		), 1, 1, false},
+		{"three way", grid(
+			".S.",
+			".+.",
+			"...",
+		), 1, 3, false},
+		{"sideways past a splitter", grid(
+			"S....",
+			"\\.^..",
+			".....",
+		), 0, 1, false},
+		{"loop that gets out", grid(
+			"...S..",
+			"./.+\\.",
+			"......",
+			".\\../.",
+			"......",
+		), 1, 0, true},
+		{"loop that's trapped", grid(
+			"#..S..#",
+			"#/.+\\.#",
+			"#.....#",
+			"#\\../.#",
+			"#######",
+			".......",
+		), 1, 0, false},
+		{"splitter on the bottom row", grid(
+			".S.",
+			"...",
+			".^.",
+		), 0, 1, false},
+		{"mirror on the bottom row", grid(
+			".S.",
+			"...",
+			"./.",
+		), 0, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := simulate(tt.lines, sources(tt.lines))
+			if got.splits != tt.splits {
+				t.Errorf("simulate() splits = %d, want %d", got.splits, tt.splits)
+			}
+			if tt.loop {
+				if !errors.Is(err, errLoop) {
+					t.Errorf("simulate() error = %v, want errLoop", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.timelines.Cmp(big.NewInt(tt.timelines)) != 0 {
+				t.Errorf("simulate() timelines = %s, want %d", got.timelines, tt.timelines)
+			}
+			if slow, err := simulateGraph(tt.lines, sources(tt.lines)); err != nil || slow.splits != tt.splits || slow.timelines.Cmp(got.timelines) != 0 {
+				t.Errorf("simulateGraph() = %d, %s, %v", slow.splits, slow.timelines, err)
+			}
+			n := int64(0)
+			for range timelines(tt.lines) {
+				n++
+			}
+			if n != tt.timelines {
+				t.Errorf("timelines() yielded %d, want %d", n, tt.timelines)
+			}
+		})
+	}
+}
+
+func Test_sources(t *testing.T) {
+	for _, name := range []string{"sample", "sources"} {
+		lines := readlines(name)
+		starts := sources(lines)
+		fast, err := simulate(lines, starts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		slow, err := simulateGraph(lines, starts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fast.splits != slow.splits || fast.merges != slow.merges || fast.timelines.Cmp(slow.timelines) != 0 {
+			t.Errorf("%s: row by row got %d splits, %d merges, %s timelines; graph got %d, %d, %s", name,
+				fast.splits, fast.merges, fast.timelines, slow.splits, slow.merges, slow.timelines)
+		}
+		total := new(big.Int)
+		for col := range fast.exits {
+			if fast.exits[col].Cmp(slow.exits[col]) != 0 {
+				t.Errorf("%s: column %d has %s exits row by row, %s from the graph", name, col, fast.exits[col], slow.exits[col])
+			}
+			total.Add(total, fast.exits[col])
+		}
+		if total.Cmp(fast.timelines) != 0 {
+			t.Errorf("%s: exits add up to %s, want %s", name, total, fast.timelines)
+		}
+
+		// each source on its own should have no more splits than all of
+		// them, and the timelines should add up
+		each, err := sourceStats(lines)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := new(big.Int)
+		for _, s := range each {
+			if s.splits > fast.splits {
+				t.Errorf("%s: one source has %d splits, more than %d for all of them", name, s.splits, fast.splits)
+			}
+			sum.Add(sum, s.timelines)
+		}
+		if sum.Cmp(fast.timelines) != 0 {
+			t.Errorf("%s: sources have %s timelines between them, want %s", name, sum, fast.timelines)
+		}
+
+		n := int64(0)
+		for tl := range timelines(lines) {
+			if !slices.ContainsFunc(starts, func(b beam) bool { return b.cell() == tl.path[0] }) {
+				t.Errorf("%s: timeline %s starts at %v, which isn't a source", name, tl, tl.path[0])
+			}
+			n++
+		}
+		if n != fast.timelines.Int64() {
+			t.Errorf("%s: timelines() yielded %d, want %s", name, n, fast.timelines)
+		}
+	}
+}
+
+func Test_heatmap(t *testing.T) {
+	for _, name := range []string{"sample", "mirrors", "sources"} {
+		lines := readlines(name)
+		h, err := newHeatmap(lines)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stats, err := simulate(lines, sources(lines))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(h.hit) != stats.splits {
+			t.Errorf("%s: %d splitters hit, want %d", name, len(h.hit), stats.splits)
+		}
+		splitters := bytes.Count(bytes.Join(lines, nil), []byte("^")) + bytes.Count(bytes.Join(lines, nil), []byte("+"))
+		if len(h.hit)+len(h.missed) != splitters {
+			t.Errorf("%s: %d hit and %d missed, want %d in all", name, len(h.hit), len(h.missed), splitters)
+		}
+		// every timeline passes through the bottom row once, at most
+		bottom := len(lines) - 1
+		for col, n := range stats.exits {
+			if h.through[bottom][col].Cmp(n) < 0 {
+				t.Errorf("%s: %s timelines through bottom column %d, but %s leave there", name, h.through[bottom][col], col, n)
+			}
+		}
+		if rows := strings.Split(strings.TrimSuffix(h.grid(), "\n"), "\n"); len(rows) != len(lines) {
+			t.Errorf("%s: grid() has %d rows, want %d", name, len(rows), len(lines))
+		}
+	}
+
+	// in a downward manifold with one source, everything goes through the
+	// source and leaves through the bottom
+	lines := readlines("sample")
+	h, err := newHeatmap(lines)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := sources(lines)[0]
+	if got, want := h.through[src.row][src.col], timelineCount(t, lines); got.Cmp(want) != 0 {
+		t.Errorf("%s timelines through the source, want %s", got, want)
+	}
+	if h.level(src.row, src.col) != 9 {
+		t.Errorf("source has level %d, want 9", h.level(src.row, src.col))
+	}
+	for _, format := range []string{"png", "gif"} {
+		var buf bytes.Buffer
+		if err := h.writeImage(&buf, format, 2); err != nil {
+			t.Fatal(err)
+		}
+		cfg, got, err := image.DecodeConfig(&buf)
+		if err != nil || got != format || cfg.Width != 2*len(lines[0]) || cfg.Height != 2*len(lines) {
+			t.Errorf("writeImage(%s) = %s %dx%d, %v", format, got, cfg.Width, cfg.Height, err)
+		}
+	}
+}
+
+// randomManifold makes a rows x cols manifold where each cell is a splitter
+// or a source with the given probabilities, and the rest are empty.
+func randomManifold(rows, cols int, splitters, sources float64, seed uint64) [][]byte {
+	rng := rand.New(rand.NewPCG(seed, 7))
+	lines := make([][]byte, rows)
+	for r := range lines {
+		lines[r] = bytes.Repeat([]byte("."), cols)
+		for c := range lines[r] {
+			switch p := rng.Float64(); {
+			case p < splitters:
+				lines[r][c] = '^'
+			case p < splitters+sources:
+				lines[r][c] = 'S'
+			}
+		}
+	}
+	return lines
+}
+
+// Test_rowsVsGraph checks that counting a row at a time agrees with the beam
+// graph on every stat, for lots of small downward manifolds.
+func Test_rowsVsGraph(t *testing.T) {
+	for seed := range uint64(3000) {
+		rng := rand.New(rand.NewPCG(seed, 8))
+		lines := randomManifold(1+rng.IntN(8), 1+rng.IntN(8), 0.4*rng.Float64(), 0.2*rng.Float64(), seed)
+		starts := sources(lines)
+		fast, ok := simulateInt(lines, starts)
+		if !ok {
+			t.Fatalf("simulateInt() overflowed on %q", lines)
+		}
+		slow, err := simulateGraph(lines, starts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fast.splits != slow.splits || fast.merges != slow.merges || fast.timelines.Cmp(slow.timelines) != 0 ||
+			!slices.EqualFunc(fast.exits, slow.exits, func(a, b *big.Int) bool { return a.Cmp(b) == 0 }) {
+			t.Errorf("%q: row by row got %d splits, %d merges, %s timelines, exits %v; graph got %d, %d, %s, %v", lines,
+				fast.splits, fast.merges, fast.timelines, fast.exits, slow.splits, slow.merges, slow.timelines, slow.exits)
+		}
+	}
+}
+
+func Test_merges(t *testing.T) {
+	tests := []struct {
+		name   string
+		lines  [][]byte
+		merges int
+	}{
+		{"beams leave from the bottom row", grid("S.S", "^.^"), 0},
+		{"beams meet on the bottom row", grid("S.S", "^.^", "..."), 1},
+		{"beams meet on the bottom row, with an absorber", grid("S.S#", "^.^.", "...."), 1},
+		{"source where a beam already is", grid(".S.", ".S.", "..."), 1},
+		{"sample", readlines("sample"), 13},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := simulate(tt.lines, sources(tt.lines))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.merges != tt.merges {
+				t.Errorf("simulate() merges = %d, want %d", got.merges, tt.merges)
+			}
+		})
+	}
+}
+
+func Test_parseLines(t *testing.T) {
+	lines := readlines("sample")
+	withNewline := readlines("sample-newline")
+	if !slices.EqualFunc(withNewline, lines, bytes.Equal) {
+		t.Fatalf("a trailing newline gives %d rows, want %d", len(withNewline), len(lines))
+	}
+	if !downward(withNewline) {
+		t.Errorf("downward() = false with a trailing newline")
+	}
+	stats, err := simulate(withNewline, sources(withNewline))
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns := 0
+	for _, n := range stats.exits {
+		if n.Sign() > 0 {
+			columns++
+		}
+	}
+	if columns != 9 {
+		t.Errorf("timelines leave through %d columns with a trailing newline, want 9", columns)
+	}
+	if got := parseLines([]byte(".S.\r\n...\r\n")); len(got) != 2 || string(got[1]) != "..." {
+		t.Errorf("parseLines() with CRLF = %q", got)
+	}
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// The components a manifold can contain. A beam that meets one of these is
+// affected as follows:
+//
+//	.  S   the beam carries straight on
+//	^      a beam moving up or down is split to either side; it emerges
+//	       beside the splitter and keeps going the same way. Beams moving
+//	       sideways pass through.
+//	+      any beam is split three ways: to either side, as for ^, and also
+//	       straight on
+//	/  \   mirrors turn the beam through a right angle
+//	#      the beam is absorbed
+//
+// A beam that leaves the grid has finished its timeline, except that a beam
+// which is split off past the edge of the grid is simply lost, as in the
+// original puzzle. The bottom row is where the beams are collected, so a beam
+// that gets there leaves straight away, whatever is in the cell.
+
+// heading is the direction a beam is moving in, as a change in row and column.
+type heading struct {
+	dr, dc int
+}
+
+var (
+	north = heading{-1, 0}
+	south = heading{1, 0}
+	east  = heading{0, 1}
+	west  = heading{0, -1}
+)
+
+// sides returns the directions to either side of h. They're named the way
+// they'd look if the map were turned so that h pointed down the page, which
+// is how the original manifolds are drawn, so a beam moving south has its L
+// side to the west.
+func (h heading) sides() (l, r heading) {
+	return heading{h.dc, -h.dr}, heading{-h.dc, h.dr}
+}
+
+// mirror returns the heading of a beam moving in h after it hits the mirror c.
+func (h heading) mirror(c byte) heading {
+	if c == '/' {
+		return heading{-h.dc, -h.dr}
+	}
+	return heading{h.dc, h.dr}
+}
+
+// beam is a beam that has just arrived in a cell, moving in some direction.
+type beam struct {
+	row, col int
+	dir      heading
+}
+
+func (b beam) cell() [2]int {
+	return [2]int{b.row, b.col}
+}
+
+func (b beam) ahead(h heading) beam {
+	return beam{row: b.row + h.dr, col: b.col + h.dc, dir: b.dir}
+}
+
+// move is one way a beam can carry on from a cell. choice is 'L', 'R' or 'S'
+// if the beam was split, and 0 otherwise.
+type move struct {
+	to     beam
+	choice byte
+}
+
+// inside reports whether the beam is still in the grid.
+func inside(lines [][]byte, b beam) bool {
+	return b.row >= 0 && b.row < len(lines) && b.col >= 0 && b.col < len(lines[b.row])
+}
+
+// moves returns the ways a beam can go on from the cell it's in, in order of
+// choice, and whether the beam was split. Any move may leave the grid.
+func moves(lines [][]byte, b beam) ([]move, bool) {
+	if b.row == len(lines)-1 {
+		return []move{{to: beam{row: b.row + 1, col: b.col, dir: b.dir}}}, false
+	}
+	c := lines[b.row][b.col]
+	switch {
+	case c == '#':
+		return nil, false
+	case c == '/' || c == '\\':
+		b.dir = b.dir.mirror(c)
+		return []move{{to: b.ahead(b.dir)}}, false
+	case c == '+' || (c == '^' && b.dir.dc == 0):
+		var ms []move
+		l, r := b.dir.sides()
+		for _, side := range []struct {
+			h      heading
+			choice byte
+		}{{l, 'L'}, {r, 'R'}} {
+			// the beam emerges beside the splitter and carries on from there
+			if beside := b.ahead(side.h); inside(lines, beside) {
+				ms = append(ms, move{to: beside.ahead(b.dir), choice: side.choice})
+			}
+		}
+		if c == '+' {
+			ms = append(ms, move{to: b.ahead(b.dir), choice: 'S'})
+		}
+		return ms, true
+	default:
+		return []move{{to: b.ahead(b.dir)}}, false
+	}
+}
+
+// errLoop is returned when a beam can go round in a loop and still get out
+// of the manifold, so that there are infinitely many timelines.
+var errLoop = errors.New("beams can loop forever before leaving the manifold")
+
+// beamGraph holds every state a beam can reach from its sources, and where it
+// can go from each one.
+type beamGraph struct {
+	lines  [][]byte
+	starts []beam
+	// order holds the states in the order they were found
+	order []beam
+	next  map[beam][]move
+	// split holds the cells that split a beam
+	split map[[2]int]bool
+	// merges counts the times a beam arrived in a state some other beam had
+	// already reached
+	merges int
+}
+
+// newBeamGraph follows beams outward from the starts until there are no
+// states left that it hasn't seen. Loops are fine here; we just stop when we
+// get back to a state we've already been in.
+func newBeamGraph(lines [][]byte, starts []beam) *beamGraph {
+	g := &beamGraph{
+		lines:  lines,
+		starts: starts,
+		next:   make(map[beam][]move),
+		split:  make(map[[2]int]bool),
+	}
+	visit := func(b beam) {
+		if !inside(lines, b) {
+			return
+		}
+		if _, seen := g.next[b]; seen {
+			g.merges++
+			return
+		}
+		g.order = append(g.order, b)
+		g.next[b] = nil
+	}
+	for _, b := range starts {
+		visit(b)
+	}
+	for i := 0; i < len(g.order); i++ {
+		b := g.order[i]
+		ms, split := moves(lines, b)
+		g.next[b] = ms
+		if split {
+			g.split[b.cell()] = true
+		}
+		for _, m := range ms {
+			visit(m.to)
+		}
+	}
+	return g
+}
+
+// live returns the states that can get out of the grid, sorted so that every
+// state comes after all the states it leads to. That's only possible if none
+// of them are on a loop, so otherwise we return errLoop with one of the cells
+// on the loop.
+func (g *beamGraph) live() ([]beam, map[beam][]beam, error) {
+	// First find the states that can get out, working backward from the
+	// ones that leave the grid.
+	prev := make(map[beam][]beam)
+	var live []beam
+	alive := make(map[beam]bool)
+	for _, b := range g.order {
+		for _, m := range g.next[b] {
+			if inside(g.lines, m.to) {
+				prev[m.to] = append(prev[m.to], b)
+			} else if !alive[b] {
+				alive[b] = true
+				live = append(live, b)
+			}
+		}
+	}
+	for i := 0; i < len(live); i++ {
+		for _, p := range prev[live[i]] {
+			if !alive[p] {
+				alive[p] = true
+				live = append(live, p)
+			}
+		}
+	}
+
+	// Then put them in order; anything left over is on a loop or downstream
+	// of one.
+	pending := make(map[beam]int)
+	for _, b := range live {
+		for _, m := range g.next[b] {
+			if alive[m.to] {
+				pending[b]++
+			}
+		}
+	}
+	var sorted []beam
+	for _, b := range live {
+		if pending[b] == 0 {
+			sorted = append(sorted, b)
+		}
+	}
+	for i := 0; i < len(sorted); i++ {
+		for _, p := range prev[sorted[i]] {
+			if !alive[p] {
+				continue
+			}
+			pending[p]--
+			if pending[p] == 0 {
+				sorted = append(sorted, p)
+			}
+		}
+	}
+	if len(sorted) < len(live) {
+		return nil, nil, g.loop(alive, pending)
+	}
+	livePrev := make(map[beam][]beam)
+	for _, b := range sorted {
+		for _, p := range prev[b] {
+			if alive[p] {
+				livePrev[b] = append(livePrev[b], p)
+			}
+		}
+	}
+	return sorted, livePrev, nil
+}
+
+// ways counts, for every state, the timelines that carry on from there until
+// the beam leaves the grid. States that can't get out count zero, and aren't
+// in the map.
+func (g *beamGraph) ways() (map[beam]*big.Int, error) {
+	sorted, _, err := g.live()
+	if err != nil {
+		return nil, err
+	}
+	ways := make(map[beam]*big.Int)
+	for _, b := range sorted {
+		n := new(big.Int)
+		for _, m := range g.next[b] {
+			if !inside(g.lines, m.to) {
+				n.Add(n, big.NewInt(1))
+			} else if w, ok := ways[m.to]; ok {
+				n.Add(n, w)
+			}
+		}
+		ways[b] = n
+	}
+	return ways, nil
+}
+
+// reach counts, for every state that can get out, the timelines that get
+// there from the sources. It works forward, which is why the sorted states are
+// taken in reverse.
+func (g *beamGraph) reach() (map[beam]*big.Int, error) {
+	sorted, prev, err := g.live()
+	if err != nil {
+		return nil, err
+	}
+	starts := make(map[beam]int64)
+	for _, b := range g.starts {
+		starts[b]++
+	}
+	reach := make(map[beam]*big.Int)
+	for i := len(sorted) - 1; i >= 0; i-- {
+		b := sorted[i]
+		n := big.NewInt(starts[b])
+		for _, p := range prev[b] {
+			n.Add(n, reach[p])
+		}
+		reach[b] = n
+	}
+	return reach, nil
+}
+
+// exits counts the timelines that leave through each column of the bottom
+// row.
+func (g *beamGraph) exits() ([]*big.Int, error) {
+	reach, err := g.reach()
+	if err != nil {
+		return nil, err
+	}
+	bottom := len(g.lines) - 1
+	exits := make([]*big.Int, len(g.lines[bottom]))
+	for col := range exits {
+		exits[col] = new(big.Int)
+	}
+	for b, n := range reach {
+		for _, m := range g.next[b] {
+			if m.to.row > bottom && m.to.col < len(exits) {
+				exits[m.to.col].Add(exits[m.to.col], n)
+			}
+		}
+	}
+	return exits, nil
+}
+
+// loop finds a cell on a loop among the live states that couldn't be sorted.
+// Every one of those leads to another, so if we keep following them we must
+// come back to somewhere we've been.
+func (g *beamGraph) loop(alive map[beam]bool, pending map[beam]int) error {
+	var b beam
+	for _, s := range g.order {
+		if alive[s] && pending[s] > 0 {
+			b = s
+			break
+		}
+	}
+	seen := make(map[beam]bool)
+	for !seen[b] {
+		seen[b] = true
+		for _, m := range g.next[b] {
+			if alive[m.to] && pending[m.to] > 0 {
+				b = m.to
+				break
+			}
+		}
+	}
+	return fmt.Errorf("%w: row %d column %d", errLoop, b.row, b.col)
+}
+
+// downward reports whether the manifold is rectangular and only has the
+// original components, so that every beam moves down and we can count it a
+// row at a time.
+func downward(lines [][]byte) bool {
+	for _, line := range lines {
+		if len(line) != len(lines[0]) {
+			return false
+		}
+		for _, c := range line {
+			if c != '.' && c != '^' && c != 'S' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// simulateGraph works for any manifold. Its split and merge counts are right
+// even if beams loop, but the timelines are only there if err is nil.
+func simulateGraph(lines [][]byte, starts []beam) (beamStats, error) {
+	g := newBeamGraph(lines, starts)
+	stats := beamStats{splits: len(g.split), merges: g.merges}
+	ways, err := g.ways()
+	if err != nil {
+		return stats, err
+	}
+	stats.timelines = new(big.Int)
+	for _, b := range starts {
+		if w, ok := ways[b]; ok {
+			stats.timelines.Add(stats.timelines, w)
+		}
+	}
+	if stats.exits, err = g.exits(); err != nil {
+		return stats, err
+	}
+	return stats, nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// sourceStats holds the stats for each source on its own, as if it were the
+// only one in the manifold.
+func sourceStats(lines [][]byte) ([]beamStats, error) {
+	var all []beamStats
+	for _, b := range sources(lines) {
+		stats, err := simulate(lines, []beam{b})
+		if err != nil {
+			return nil, fmt.Errorf("source at row %d column %d: %w", b.row, b.col, err)
+		}
+		all = append(all, stats)
+	}
+	return all, nil
+}
+
+// writeSources reports the splits and timelines for each source and for all
+// of them together, the number of merges, and a histogram of where the
+// timelines leave the bottom row. The per-source split counts don't add up to
+// the combined one when the sources share splitters.
+func writeSources(w io.Writer, lines [][]byte) error {
+	each, err := sourceStats(lines)
+	if err != nil {
+		return err
+	}
+	for i, b := range sources(lines) {
+		fmt.Fprintf(w, "source %d at row %d column %d: %d splits, %s timelines\n",
+			i+1, b.row, b.col, each[i].splits, each[i].timelines)
+	}
+	all, err := simulate(lines, sources(lines))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "combined: %d splits, %s timelines, %d merges\n", all.splits, all.timelines, all.merges)
+	fmt.Fprintln(w, "exits:")
+	for col, n := range all.exits {
+		if n.Sign() > 0 {
+			fmt.Fprintf(w, "%4d: %s\n", col, n)
+		}
+	}
+	return nil
+}
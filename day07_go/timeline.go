@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+	"math/big"
+	"math/rand/v2"
+)
+
+// timeline is one of the paths a particle can take through the manifold.
+type timeline struct {
+	// choices holds 'L', 'R' or 'S' for each splitter the particle hits, in
+	// order. At the edge of the manifold there may be only one way to go, but
+	// it still counts as a choice.
+	choices []byte
+	// path holds the cells the particle passes through, from the source until
+	// it leaves the grid. It skips over the cells beside splitters that it
+	// emerges from.
+	path [][2]int
+}
+
+func (t timeline) String() string {
+	return string(t.choices)
+}
+
+// timelineIndex counts, for every state a beam can be in, how many timelines
+// carry on from there until it leaves the manifold. That's what we need to
+// find a timeline by its position without enumerating the ones before it.
+type timelineIndex struct {
+	graph *beamGraph
+	ways  map[beam]*big.Int
+}
+
+func newTimelineIndex(lines [][]byte) (*timelineIndex, error) {
+	g := newBeamGraph(lines, sources(lines))
+	ways, err := g.ways()
+	if err != nil {
+		return nil, err
+	}
+	return &timelineIndex{graph: g, ways: ways}, nil
+}
+
+// count is the number of timelines that go on from b, which is one if the
+// beam has just left the grid.
+func (x *timelineIndex) count(b beam) *big.Int {
+	if !inside(x.graph.lines, b) {
+		return big.NewInt(1)
+	}
+	if w, ok := x.ways[b]; ok {
+		return w
+	}
+	return new(big.Int)
+}
+
+// total is the number of timelines from all the sources; it agrees with
+// simulate.
+func (x *timelineIndex) total() *big.Int {
+	total := new(big.Int)
+	for _, b := range x.graph.starts {
+		total.Add(total, x.count(b))
+	}
+	return total
+}
+
+// kth returns the k-th timeline (starting from 0), taking the sources in
+// order and then the timelines from each one in lexicographic order of
+// choices. At each splitter, if k is less than the number of timelines that
+// go the first way, we go that way; otherwise we skip past all of those and
+// try the next way. Picking the source works the same way.
+func (x *timelineIndex) kth(k *big.Int) (timeline, error) {
+	total := x.total()
+	if k.Sign() < 0 || k.Cmp(total) >= 0 {
+		return timeline{}, fmt.Errorf("timeline %s is out of range, there are %s", k, total)
+	}
+	k = new(big.Int).Set(k)
+	var b beam
+	for _, b = range x.graph.starts {
+		n := x.count(b)
+		if k.Cmp(n) < 0 {
+			break
+		}
+		k.Sub(k, n)
+	}
+	t := timeline{}
+	for inside(x.graph.lines, b) {
+		t.path = append(t.path, b.cell())
+		for _, m := range x.graph.next[b] {
+			n := x.count(m.to)
+			if k.Cmp(n) >= 0 {
+				k.Sub(k, n)
+				continue
+			}
+			if m.choice != 0 {
+				t.choices = append(t.choices, m.choice)
+			}
+			b = m.to
+			break
+		}
+	}
+	return t, nil
+}
+
+// random picks a timeline uniformly at random.
+func (x *timelineIndex) random(rng *rand.Rand) (timeline, error) {
+	if x.total().Sign() == 0 {
+		return timeline{}, errors.New("there are no timelines to pick from")
+	}
+	return x.kth(randBig(rng, x.total()))
+}
+
+// randBig returns a uniform random number in [0, n). It fills in enough
+// random bits to cover n and tries again if the result is too big, which
+// happens less than half the time.
+func randBig(rng *rand.Rand, n *big.Int) *big.Int {
+	bits := n.BitLen()
+	mask := new(big.Int).Lsh(big.NewInt(1), uint(bits))
+	mask.Sub(mask, big.NewInt(1))
+	for {
+		buf := make([]byte, (bits+7)/8)
+		for i := range buf {
+			buf[i] = byte(rng.Uint32())
+		}
+		r := new(big.Int).SetBytes(buf)
+		r.And(r, mask)
+		if r.Cmp(n) < 0 {
+			return r
+		}
+	}
+}
+
+// kthTimeline returns the k-th timeline in lexicographic order.
+func kthTimeline(lines [][]byte, k *big.Int) (timeline, error) {
+	x, err := newTimelineIndex(lines)
+	if err != nil {
+		return timeline{}, err
+	}
+	return x.kth(k)
+}
+
+// timelines yields every timeline in lexicographic order. There aren't any
+// if the beams can loop.
+func timelines(lines [][]byte) iter.Seq[timeline] {
+	return func(yield func(timeline) bool) {
+		x, err := newTimelineIndex(lines)
+		if err != nil {
+			return
+		}
+		for k := new(big.Int); k.Cmp(x.total()) < 0; k.Add(k, big.NewInt(1)) {
+			t, _ := x.kth(k)
+			if !yield(t) {
+				return
+			}
+		}
+	}
+}